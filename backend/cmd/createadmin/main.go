@@ -0,0 +1,65 @@
+// Command createadmin creates an admin account, typically the first one on a
+// fresh database. The password is read from the first line of stdin so it
+// does not end up in the shell history:
+//
+//	echo "$ADMIN_PASSWORD" | go run ./cmd/createadmin -email admin@example.com -name "Admin"
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/mhakimsaputra17/discount-voucher-management/backend/internal/auth"
+	"github.com/mhakimsaputra17/discount-voucher-management/backend/internal/config"
+	"github.com/mhakimsaputra17/discount-voucher-management/backend/internal/database"
+	"github.com/mhakimsaputra17/discount-voucher-management/backend/internal/logger"
+)
+
+func main() {
+	email := flag.String("email", "", "email address of the new admin (required)")
+	name := flag.String("name", "", "display name of the new admin")
+	flag.Parse()
+
+	if *email == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && password == "" {
+		log.Fatalf("failed to read password from stdin: %v", err)
+	}
+	password = strings.TrimRight(password, "\r\n")
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("failed to load config: %v", err)
+	}
+
+	ctx := context.Background()
+	db, err := database.Connect(ctx, cfg)
+	if err != nil {
+		log.Fatalf("failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	service := auth.NewService(auth.NewRepository(db), cfg, logger.New(cfg.Env))
+	user, appErr := service.CreateUser(ctx, auth.CreateUserInput{
+		Email:    *email,
+		Name:     *name,
+		Password: password,
+		Role:     auth.RoleAdmin,
+	})
+	if appErr != nil {
+		if appErr.Err != nil {
+			log.Fatalf("failed to create admin: %s: %v", appErr.Message, appErr.Err)
+		}
+		log.Fatalf("failed to create admin: %s", appErr.Message)
+	}
+
+	log.Printf("created admin %s (id %d)", user.Email, user.ID)
+}
@@ -8,11 +8,14 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/mhakimsaputra17/discount-voucher-management/backend/internal/audit"
 	"github.com/mhakimsaputra17/discount-voucher-management/backend/internal/auth"
+	"github.com/mhakimsaputra17/discount-voucher-management/backend/internal/campaign"
 	"github.com/mhakimsaputra17/discount-voucher-management/backend/internal/config"
 	"github.com/mhakimsaputra17/discount-voucher-management/backend/internal/database"
 	"github.com/mhakimsaputra17/discount-voucher-management/backend/internal/http/middleware"
 	"github.com/mhakimsaputra17/discount-voucher-management/backend/internal/http/router"
+	"github.com/mhakimsaputra17/discount-voucher-management/backend/internal/idempotency"
 	"github.com/mhakimsaputra17/discount-voucher-management/backend/internal/logger"
 	"github.com/mhakimsaputra17/discount-voucher-management/backend/internal/voucher"
 )
@@ -41,19 +44,38 @@ func NewServer(ctx context.Context) (*Server, error) {
 		return nil, err
 	}
 
+	campaignRepo := campaign.NewRepository(dbPool)
+	campaignService := campaign.NewService(campaignRepo, cfg)
+	campaignHandler := campaign.NewHandler(campaignService)
+
 	voucherRepo := voucher.NewRepository(dbPool)
-	voucherService := voucher.NewService(voucherRepo, cfg, log)
+	voucherService := voucher.NewService(voucherRepo, campaignService, cfg, log)
 	voucherHandler := voucher.NewHandler(voucherService)
+	go voucherService.RunReservationSweeper(ctx, cfg.ReservationSweep)
+
+	auditRepo := audit.NewRepository(dbPool)
+	auditService := audit.NewService(auditRepo, cfg)
+	auditHandler := audit.NewHandler(auditService)
 
-	authService := auth.NewService(cfg.AuthToken)
+	authRepo := auth.NewRepository(dbPool)
+	authService := auth.NewService(authRepo, cfg, log)
+	if err := authService.LoadSigningKeys(ctx); err != nil {
+		dbPool.Close()
+		return nil, fmt.Errorf("load signing keys: %w", err)
+	}
+	go authService.RunKeyReloader(ctx)
 	authHandler := auth.NewHandler(authService)
-	authMiddleware := middleware.NewAuthMiddleware(cfg.AuthToken)
+	authMiddleware := middleware.NewAuthMiddleware(authService)
 	corsMiddleware := middleware.NewCORSMiddleware(cfg.CORSAllowedOrigins)
 
+	idempotencyStore := idempotency.NewStore(dbPool, cfg.IdempotencyTTL, cfg.IdempotencyLease)
+	idempotencyMiddleware := middleware.NewIdempotencyMiddleware(idempotencyStore, cfg.QueryTimeout, cfg.IdempotencyMaxBody)
+	go idempotencyStore.RunCleanup(ctx, time.Hour, cfg.QueryTimeout, log)
+
 	r := gin.New()
-	r.Use(gin.Logger(), gin.Recovery(), corsMiddleware)
+	r.Use(middleware.NewRequestIDMiddleware(), gin.Logger(), gin.Recovery(), corsMiddleware)
 
-	router.RegisterRoutes(r, authHandler, authMiddleware, voucherHandler)
+	router.RegisterRoutes(r, authHandler, authMiddleware, idempotencyMiddleware, voucherHandler, campaignHandler, auditHandler)
 
 	srv := &http.Server{
 		Addr:              fmt.Sprintf(":%s", cfg.ServerPort),
@@ -0,0 +1,105 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+
+	"github.com/mhakimsaputra17/discount-voucher-management/backend/internal/common"
+)
+
+// ignoredFields are derived or bookkeeping fields that change without anyone
+// having changed the voucher, so they would only add noise to the diff.
+var ignoredFields = map[string]struct{}{
+	"id":               {},
+	"status":           {},
+	"expires_at":       {},
+	"redemption_count": {},
+	"version":          {},
+	"created_at":       {},
+	"updated_at":       {},
+}
+
+// NewEntry builds the entry for an action on a voucher, taking the actor and
+// request ID from ctx. before and after are snapshots of the voucher; pass
+// nil for the side on which it did not exist.
+func NewEntry(ctx context.Context, voucherID int64, action string, before, after any) (Entry, error) {
+	changes, err := Diff(before, after)
+	if err != nil {
+		return Entry{}, err
+	}
+
+	entry := Entry{
+		VoucherID: voucherID,
+		Action:    action,
+		Actor:     common.ActorFromContext(ctx),
+		Changes:   changes,
+	}
+	if requestID := common.RequestIDFromContext(ctx); requestID != "" {
+		entry.RequestID = &requestID
+	}
+	return entry, nil
+}
+
+// Diff compares the JSON encodings of two snapshots field by field and
+// returns the fields that differ. null and an empty array are treated as the
+// same value.
+func Diff(before, after any) (map[string]Change, error) {
+	beforeFields, err := jsonFields(before)
+	if err != nil {
+		return nil, err
+	}
+	afterFields, err := jsonFields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make(map[string]Change)
+	for field, value := range beforeFields {
+		if _, ignored := ignoredFields[field]; ignored {
+			continue
+		}
+		if !sameValue(value, afterFields[field]) {
+			changes[field] = Change{Before: value, After: afterFields[field]}
+		}
+	}
+	for field, value := range afterFields {
+		if _, ignored := ignoredFields[field]; ignored {
+			continue
+		}
+		if _, seen := beforeFields[field]; !seen && !sameValue(nil, value) {
+			changes[field] = Change{After: value}
+		}
+	}
+	return changes, nil
+}
+
+func jsonFields(snapshot any) (map[string]json.RawMessage, error) {
+	if snapshot == nil {
+		return nil, nil
+	}
+	raw, err := json.Marshal(snapshot)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+func sameValue(a, b json.RawMessage) bool {
+	if isEmpty(a) && isEmpty(b) {
+		return true
+	}
+	return bytes.Equal(a, b)
+}
+
+func isEmpty(raw json.RawMessage) bool {
+	switch string(raw) {
+	case "", "null", "[]":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,132 @@
+package audit
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mhakimsaputra17/discount-voucher-management/backend/internal/common"
+	"github.com/mhakimsaputra17/discount-voucher-management/backend/internal/http/response"
+)
+
+const dateLayout = "2006-01-02"
+
+type Handler struct {
+	service *Service
+}
+
+func NewHandler(service *Service) *Handler {
+	return &Handler{service: service}
+}
+
+// List serves GET /audit?actor=&action=&from=&to=.
+func (h *Handler) List(c *gin.Context) {
+	params, appErr := parseListParams(c)
+	if appErr != nil {
+		response.Error(c, appErr)
+		return
+	}
+
+	result, appErr := h.service.List(c.Request.Context(), params)
+	if appErr != nil {
+		response.Error(c, appErr)
+		return
+	}
+
+	response.Success(c, http.StatusOK, result)
+}
+
+// History serves GET /vouchers/:id/history. It keeps working after the
+// voucher has been purged.
+func (h *Handler) History(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || id <= 0 {
+		response.Error(c, common.NewValidationError("invalid voucher id", err))
+		return
+	}
+
+	params, appErr := parseListParams(c)
+	if appErr != nil {
+		response.Error(c, appErr)
+		return
+	}
+	params.VoucherID = &id
+
+	result, appErr := h.service.List(c.Request.Context(), params)
+	if appErr != nil {
+		response.Error(c, appErr)
+		return
+	}
+
+	response.Success(c, http.StatusOK, result)
+}
+
+func parseListParams(c *gin.Context) (ListParams, *common.AppError) {
+	limit := parseQueryInt(c, "limit", 20)
+	page := parseQueryInt(c, "page", 1)
+	if page < 1 {
+		page = 1
+	}
+	if limit <= 0 {
+		limit = 20
+	}
+	if limit > 100 {
+		limit = 100
+	}
+
+	params := ListParams{
+		Actor:  strings.TrimSpace(c.Query("actor")),
+		Action: strings.TrimSpace(c.Query("action")),
+		Limit:  int32(limit),
+		Offset: int32((page - 1) * limit),
+	}
+
+	if raw := strings.TrimSpace(c.Query("from")); raw != "" {
+		from, err := parseTime(raw, false)
+		if err != nil {
+			return ListParams{}, common.NewValidationError("invalid from, use YYYY-MM-DD or RFC 3339", err)
+		}
+		params.From = &from
+	}
+	if raw := strings.TrimSpace(c.Query("to")); raw != "" {
+		to, err := parseTime(raw, true)
+		if err != nil {
+			return ListParams{}, common.NewValidationError("invalid to, use YYYY-MM-DD or RFC 3339", err)
+		}
+		params.To = &to
+	}
+
+	return params, nil
+}
+
+// parseTime accepts an RFC 3339 timestamp or a date. Dates are taken in UTC;
+// a date used as an upper bound includes the whole day.
+func parseTime(raw string, endOfDay bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(dateLayout, raw)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+func parseQueryInt(c *gin.Context, key string, fallback int) int {
+	valueStr := c.Query(key)
+	if valueStr == "" {
+		return fallback
+	}
+
+	value, err := strconv.Atoi(valueStr)
+	if err != nil {
+		return fallback
+	}
+
+	return value
+}
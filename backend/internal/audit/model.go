@@ -0,0 +1,72 @@
+// Package audit keeps an append-only log of changes made to vouchers: who
+// made them, when, from which request, and what the voucher looked like
+// before and after.
+package audit
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	ActionCreate   = "create"
+	ActionUpdate   = "update"
+	ActionDelete   = "delete"
+	ActionRestore  = "restore"
+	ActionPurge    = "purge"
+	ActionImport   = "import"
+	ActionGenerate = "generate"
+)
+
+var actions = map[string]struct{}{
+	ActionCreate:   {},
+	ActionUpdate:   {},
+	ActionDelete:   {},
+	ActionRestore:  {},
+	ActionPurge:    {},
+	ActionImport:   {},
+	ActionGenerate: {},
+}
+
+// Change holds the JSON value of a field before and after an action. Before
+// is null for a voucher that was just created and After is null for one that
+// was purged.
+type Change struct {
+	Before json.RawMessage `json:"before"`
+	After  json.RawMessage `json:"after"`
+}
+
+// Entry is one row of the audit log. Changes only lists the fields that
+// actually changed.
+type Entry struct {
+	ID        int64             `json:"id" db:"id"`
+	VoucherID int64             `json:"voucher_id" db:"voucher_id"`
+	Action    string            `json:"action" db:"action"`
+	Actor     string            `json:"actor" db:"actor"`
+	RequestID *string           `json:"request_id" db:"request_id"`
+	Changes   map[string]Change `json:"changes" db:"changes"`
+	CreatedAt string            `json:"created_at" db:"created_at"`
+}
+
+// ListParams filters the audit log. From is inclusive and To is exclusive.
+type ListParams struct {
+	VoucherID *int64
+	Actor     string
+	Action    string
+	From      *time.Time
+	To        *time.Time
+	Limit     int32
+	Offset    int32
+}
+
+type PaginationMeta struct {
+	Page       int `json:"page"`
+	Limit      int `json:"limit"`
+	Total      int `json:"total"`
+	TotalPages int `json:"total_pages"`
+}
+
+type ListResponse struct {
+	Data       []Entry        `json:"data"`
+	Pagination PaginationMeta `json:"pagination"`
+}
@@ -0,0 +1,148 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/mhakimsaputra17/discount-voucher-management/backend/internal/database"
+)
+
+// entryColumns is the select list shared by every query that returns an
+// Entry; keep it in sync with scanEntry.
+const entryColumns = `id,
+		voucher_id,
+		action,
+		actor,
+		request_id,
+		changes,
+		TO_CHAR(created_at AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS"Z"') AS created_at`
+
+// Repository reads the audit log. Entries are written with Insert from the
+// transaction that made the change.
+type Repository struct {
+	db *pgxpool.Pool
+}
+
+func NewRepository(db *pgxpool.Pool) *Repository {
+	return &Repository{db: db}
+}
+
+// Insert appends entries to the audit log. q should be the transaction that
+// made the changes, so a change is never committed without its entry.
+func Insert(ctx context.Context, q database.Querier, entries ...Entry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	voucherIDs := make([]int64, len(entries))
+	actionList := make([]string, len(entries))
+	actors := make([]string, len(entries))
+	requestIDs := make([]*string, len(entries))
+	changes := make([]string, len(entries))
+	for i, e := range entries {
+		raw, err := json.Marshal(e.Changes)
+		if err != nil {
+			return err
+		}
+		voucherIDs[i] = e.VoucherID
+		actionList[i] = e.Action
+		actors[i] = e.Actor
+		requestIDs[i] = e.RequestID
+		changes[i] = string(raw)
+	}
+
+	_, err := q.Exec(ctx, `
+		INSERT INTO voucher_audit (voucher_id, action, actor, request_id, changes)
+		SELECT * FROM UNNEST($1::BIGINT[], $2::TEXT[], $3::TEXT[], $4::TEXT[], $5::TEXT[]::JSONB[])
+	`, voucherIDs, actionList, actors, requestIDs, changes)
+	return err
+}
+
+func (r *Repository) List(ctx context.Context, params ListParams) ([]Entry, int, error) {
+	args := []any{}
+	whereClauses := []string{"1=1"}
+
+	if params.VoucherID != nil {
+		args = append(args, *params.VoucherID)
+		whereClauses = append(whereClauses, fmt.Sprintf("voucher_id = $%d", len(args)))
+	}
+	if params.Actor != "" {
+		args = append(args, params.Actor)
+		whereClauses = append(whereClauses, fmt.Sprintf("actor = $%d", len(args)))
+	}
+	if params.Action != "" {
+		args = append(args, params.Action)
+		whereClauses = append(whereClauses, fmt.Sprintf("action = $%d", len(args)))
+	}
+	if params.From != nil {
+		args = append(args, *params.From)
+		whereClauses = append(whereClauses, fmt.Sprintf("created_at >= $%d", len(args)))
+	}
+	if params.To != nil {
+		args = append(args, *params.To)
+		whereClauses = append(whereClauses, fmt.Sprintf("created_at < $%d", len(args)))
+	}
+
+	limitPlaceholder := len(args) + 1
+	offsetPlaceholder := limitPlaceholder + 1
+
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM voucher_audit
+		WHERE %s
+		ORDER BY id DESC
+		LIMIT $%d OFFSET $%d
+	`, entryColumns, strings.Join(whereClauses, " AND "), limitPlaceholder, offsetPlaceholder)
+
+	argsWithLimit := append(args, params.Limit, params.Offset)
+
+	rows, err := r.db.Query(ctx, query, argsWithLimit...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var entries []Entry
+	for rows.Next() {
+		e, err := scanEntry(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		entries = append(entries, e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	countQuery := fmt.Sprintf(`
+		SELECT COUNT(*)
+		FROM voucher_audit
+		WHERE %s
+	`, strings.Join(whereClauses, " AND "))
+
+	var total int
+	if err := r.db.QueryRow(ctx, countQuery, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	return entries, total, nil
+}
+
+func scanEntry(row pgx.Row) (Entry, error) {
+	var e Entry
+	err := row.Scan(
+		&e.ID,
+		&e.VoucherID,
+		&e.Action,
+		&e.Actor,
+		&e.RequestID,
+		&e.Changes,
+		&e.CreatedAt,
+	)
+	return e, err
+}
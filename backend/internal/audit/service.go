@@ -0,0 +1,64 @@
+package audit
+
+import (
+	"context"
+
+	"github.com/mhakimsaputra17/discount-voucher-management/backend/internal/common"
+	"github.com/mhakimsaputra17/discount-voucher-management/backend/internal/config"
+)
+
+type Service struct {
+	repo *Repository
+	cfg  config.Config
+}
+
+func NewService(repo *Repository, cfg config.Config) *Service {
+	return &Service{repo: repo, cfg: cfg}
+}
+
+// List returns audit entries newest first.
+func (s *Service) List(ctx context.Context, params ListParams) (ListResponse, *common.AppError) {
+	if params.Action != "" {
+		if _, ok := actions[params.Action]; !ok {
+			return ListResponse{}, common.NewValidationError("invalid action", nil)
+		}
+	}
+	if params.From != nil && params.To != nil && !params.From.Before(*params.To) {
+		return ListResponse{}, common.NewValidationError("from must be before to", nil)
+	}
+
+	limit := params.Limit
+	if limit <= 0 {
+		limit = 10
+	}
+	params.Limit = limit
+
+	if params.Offset < 0 {
+		params.Offset = 0
+	}
+
+	page := int(params.Offset/limit) + 1
+
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.QueryTimeout)
+	defer cancel()
+
+	entries, total, err := s.repo.List(ctx, params)
+	if err != nil {
+		return ListResponse{}, common.NewInternalError("failed to list audit entries", err)
+	}
+	if entries == nil {
+		entries = make([]Entry, 0)
+	}
+
+	totalPages := (total + int(limit) - 1) / int(limit)
+
+	return ListResponse{
+		Data: entries,
+		Pagination: PaginationMeta{
+			Page:       page,
+			Limit:      int(limit),
+			Total:      total,
+			TotalPages: totalPages,
+		},
+	}, nil
+}
@@ -0,0 +1,30 @@
+package auth
+
+import (
+	"context"
+	"strings"
+)
+
+type claimsContextKey struct{}
+
+// WithClaims returns a copy of ctx carrying the claims of the verified
+// access token.
+func WithClaims(ctx context.Context, claims Claims) context.Context {
+	return context.WithValue(ctx, claimsContextKey{}, claims)
+}
+
+// ClaimsFromContext returns the claims stored by WithClaims.
+func ClaimsFromContext(ctx context.Context) (Claims, bool) {
+	claims, ok := ctx.Value(claimsContextKey{}).(Claims)
+	return claims, ok
+}
+
+// BearerToken extracts the token from an "Authorization: Bearer <token>"
+// header value. ok is false when the header is missing or malformed.
+func BearerToken(header string) (string, bool) {
+	parts := strings.SplitN(header, " ", 2)
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") || strings.TrimSpace(parts[1]) == "" {
+		return "", false
+	}
+	return strings.TrimSpace(parts[1]), true
+}
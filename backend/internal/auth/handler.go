@@ -2,6 +2,7 @@ package auth
 
 import (
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"github.com/mhakimsaputra17/discount-voucher-management/backend/internal/common"
@@ -17,10 +18,6 @@ type loginRequest struct {
 	Password string `json:"password" binding:"required"`
 }
 
-type loginResponse struct {
-	Token string `json:"token"`
-}
-
 func NewHandler(service *Service) *Handler {
 	return &Handler{service: service}
 }
@@ -32,7 +29,128 @@ func (h *Handler) Login(c *gin.Context) {
 		return
 	}
 
-	response.Success(c, http.StatusOK, loginResponse{Token: h.service.token})
+	result, appErr := h.service.Login(c.Request.Context(), req.Email, req.Password)
+	if appErr != nil {
+		response.Error(c, appErr)
+		return
+	}
+
+	response.Success(c, http.StatusOK, result)
+}
+
+func (h *Handler) Refresh(c *gin.Context) {
+	var input RefreshInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		response.Error(c, commonValidationError(err))
+		return
+	}
+
+	result, appErr := h.service.Refresh(c.Request.Context(), input.RefreshToken)
+	if appErr != nil {
+		response.Error(c, appErr)
+		return
+	}
+
+	response.Success(c, http.StatusOK, result)
+}
+
+// Logout revokes the session of the refresh token in the body.
+func (h *Handler) Logout(c *gin.Context) {
+	var input RefreshInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		response.Error(c, commonValidationError(err))
+		return
+	}
+
+	if appErr := h.service.Logout(c.Request.Context(), input.RefreshToken); appErr != nil {
+		response.Error(c, appErr)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *Handler) Me(c *gin.Context) {
+	claims, ok := ClaimsFromContext(c.Request.Context())
+	if !ok {
+		response.Error(c, common.NewUnauthorizedError("invalid token", nil))
+		return
+	}
+
+	user, appErr := h.service.Me(c.Request.Context(), claims)
+	if appErr != nil {
+		response.Error(c, appErr)
+		return
+	}
+
+	response.Success(c, http.StatusOK, user)
+}
+
+// JWKS publishes the public signing keys. It is cached briefly; verifiers
+// should refetch it when they see a token with an unknown kid.
+func (h *Handler) JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=60")
+	response.Success(c, http.StatusOK, h.service.JWKS())
+}
+
+func (h *Handler) RotateSigningKey(c *gin.Context) {
+	jwks, appErr := h.service.RotateSigningKey(c.Request.Context())
+	if appErr != nil {
+		response.Error(c, appErr)
+		return
+	}
+
+	response.Success(c, http.StatusOK, jwks)
+}
+
+func (h *Handler) ListUsers(c *gin.Context) {
+	users, appErr := h.service.ListUsers(c.Request.Context())
+	if appErr != nil {
+		response.Error(c, appErr)
+		return
+	}
+
+	response.Success(c, http.StatusOK, users)
+}
+
+func (h *Handler) CreateUser(c *gin.Context) {
+	var input CreateUserInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		response.Error(c, commonValidationError(err))
+		return
+	}
+
+	user, appErr := h.service.CreateUser(c.Request.Context(), input)
+	if appErr != nil {
+		response.Error(c, appErr)
+		return
+	}
+
+	response.Success(c, http.StatusCreated, user)
+}
+
+func (h *Handler) Deactivate(c *gin.Context) {
+	h.setActive(c, false)
+}
+
+func (h *Handler) Activate(c *gin.Context) {
+	h.setActive(c, true)
+}
+
+func (h *Handler) setActive(c *gin.Context, active bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || id <= 0 {
+		response.Error(c, common.NewValidationError("invalid user id", err))
+		return
+	}
+
+	user, appErr := h.service.SetActive(c.Request.Context(), id, active)
+	if appErr != nil {
+		response.Error(c, appErr)
+		return
+	}
+
+	response.Success(c, http.StatusOK, user)
 }
 
 func commonValidationError(err error) *common.AppError {
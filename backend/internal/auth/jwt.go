@@ -0,0 +1,217 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Access tokens are JWTs (RFC 7519) signed with EdDSA over Ed25519 (RFC
+// 8037). Other services verify them with the keys published at
+// /.well-known/jwks.json.
+const (
+	jwtAlgorithm = "EdDSA"
+	jwtType      = "JWT"
+)
+
+var (
+	errMalformedToken = errors.New("malformed token")
+	errUnknownKey     = errors.New("token signed with an unknown key")
+	errBadSignature   = errors.New("invalid token signature")
+)
+
+type jwtHeader struct {
+	Algorithm string `json:"alg"`
+	Type      string `json:"typ,omitempty"`
+	KeyID     string `json:"kid"`
+}
+
+// Claims are the claims carried by an access token. Subject is the user ID.
+type Claims struct {
+	Issuer    string   `json:"iss"`
+	Subject   string   `json:"sub"`
+	Email     string   `json:"email"`
+	Roles     []string `json:"roles"`
+	IssuedAt  int64    `json:"iat"`
+	ExpiresAt int64    `json:"exp"`
+	ID        string   `json:"jti"`
+}
+
+// HasRole reports whether the token grants role.
+func (c Claims) HasRole(role string) bool {
+	for _, r := range c.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// signingKey is an Ed25519 key pair from auth_signing_keys. RetiredAt is
+// nil for the active key.
+type signingKey struct {
+	ID         string
+	PrivateKey ed25519.PrivateKey
+	CreatedAt  time.Time
+	RetiredAt  *time.Time
+}
+
+func (k signingKey) publicKey() ed25519.PublicKey {
+	return k.PrivateKey.Public().(ed25519.PublicKey)
+}
+
+// JWK is a public Ed25519 key in JSON Web Key form (RFC 8037).
+type JWK struct {
+	KeyType   string `json:"kty"`
+	Curve     string `json:"crv"`
+	X         string `json:"x"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+func (k signingKey) jwk() JWK {
+	return JWK{
+		KeyType:   "OKP",
+		Curve:     "Ed25519",
+		X:         base64.RawURLEncoding.EncodeToString(k.publicKey()),
+		KeyID:     k.ID,
+		Use:       "sig",
+		Algorithm: jwtAlgorithm,
+	}
+}
+
+// keyID returns the RFC 7638 thumbprint of an Ed25519 public key, so a key
+// ID always identifies the same key.
+func keyID(public ed25519.PublicKey) string {
+	canonical := `{"crv":"Ed25519","kty":"OKP","x":"` + base64.RawURLEncoding.EncodeToString(public) + `"}`
+	sum := sha256.Sum256([]byte(canonical))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// keyring holds the keys loaded from the database: the active one signs new
+// tokens, all of them verify.
+type keyring struct {
+	mu       sync.RWMutex
+	active   *signingKey
+	keys     map[string]signingKey
+	loadedAt time.Time
+}
+
+func (r *keyring) set(keys []signingKey) {
+	byID := make(map[string]signingKey, len(keys))
+	var active *signingKey
+	for i, k := range keys {
+		byID[k.ID] = k
+		if k.RetiredAt == nil {
+			active = &keys[i]
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.keys = byID
+	r.active = active
+	r.loadedAt = time.Now()
+}
+
+func (r *keyring) activeKey() (signingKey, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.active == nil {
+		return signingKey{}, false
+	}
+	return *r.active, true
+}
+
+func (r *keyring) key(id string) (signingKey, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	k, ok := r.keys[id]
+	return k, ok
+}
+
+func (r *keyring) loadedSince(d time.Duration) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return time.Since(r.loadedAt) < d
+}
+
+func (r *keyring) jwks() JWKSet {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	set := JWKSet{Keys: make([]JWK, 0, len(r.keys))}
+	if r.active != nil {
+		set.Keys = append(set.Keys, r.active.jwk())
+	}
+	for _, k := range r.keys {
+		if k.RetiredAt != nil {
+			set.Keys = append(set.Keys, k.jwk())
+		}
+	}
+	return set
+}
+
+func signJWT(key signingKey, claims Claims) (string, error) {
+	header, err := json.Marshal(jwtHeader{Algorithm: jwtAlgorithm, Type: jwtType, KeyID: key.ID})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	signature := ed25519.Sign(key.PrivateKey, []byte(signingInput))
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// parseJWT splits token and decodes its header without checking anything
+// else; the caller picks the key from the header and calls verifyJWT.
+func parseJWT(token string) (jwtHeader, []string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return jwtHeader{}, nil, errMalformedToken
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return jwtHeader{}, nil, errMalformedToken
+	}
+	var header jwtHeader
+	if err := json.Unmarshal(raw, &header); err != nil || header.Algorithm != jwtAlgorithm || header.KeyID == "" {
+		return jwtHeader{}, nil, errMalformedToken
+	}
+	return header, parts, nil
+}
+
+// verifyJWT checks the signature of a token split by parseJWT and decodes
+// its claims. Issuer and expiry are checked by the caller.
+func verifyJWT(key signingKey, parts []string) (Claims, error) {
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Claims{}, errMalformedToken
+	}
+	if !ed25519.Verify(key.publicKey(), []byte(parts[0]+"."+parts[1]), signature) {
+		return Claims{}, errBadSignature
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return Claims{}, errMalformedToken
+	}
+	var claims Claims
+	if err := json.Unmarshal(raw, &claims); err != nil {
+		return Claims{}, errMalformedToken
+	}
+	return claims, nil
+}
@@ -0,0 +1,49 @@
+package auth
+
+const (
+	RoleStaff = "staff"
+	RoleAdmin = "admin"
+)
+
+const (
+	minPasswordLength = 12
+	// bcrypt ignores everything after the first 72 bytes.
+	maxPasswordLength = 72
+	passwordHashCost  = 12
+	refreshTokenBytes = 32
+)
+
+// User is a staff account. The password hash never leaves the repository.
+type User struct {
+	ID          int64   `json:"id" db:"id"`
+	Email       string  `json:"email" db:"email"`
+	Name        string  `json:"name" db:"name"`
+	Role        string  `json:"role" db:"role"`
+	Active      bool    `json:"active" db:"active"`
+	LastLoginAt *string `json:"last_login_at" db:"last_login_at"`
+	CreatedAt   string  `json:"created_at" db:"created_at"`
+	UpdatedAt   string  `json:"updated_at" db:"updated_at"`
+}
+
+type CreateUserInput struct {
+	Email    string `json:"email" binding:"required,email"`
+	Name     string `json:"name"`
+	Password string `json:"password" binding:"required"`
+	Role     string `json:"role" binding:"omitempty,oneof=staff admin"`
+}
+
+type RefreshInput struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// TokenResponse is returned by login and refresh. AccessToken is sent as a
+// bearer token until it expires, ExpiresIn seconds from now; RefreshToken
+// gets a new pair once and works until RefreshExpiresAt.
+type TokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	TokenType        string `json:"token_type"`
+	ExpiresIn        int64  `json:"expires_in"`
+	RefreshToken     string `json:"refresh_token"`
+	RefreshExpiresAt string `json:"refresh_expires_at"`
+	User             User   `json:"user"`
+}
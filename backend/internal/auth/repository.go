@@ -0,0 +1,323 @@
+package auth
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// userColumns is the select list shared by every query that returns a User;
+// keep it in sync with scanUser.
+const userColumns = `users.id,
+		users.email,
+		users.name,
+		users.role,
+		users.active,
+		TO_CHAR(users.last_login_at AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS"Z"') AS last_login_at,
+		TO_CHAR(users.created_at AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS"Z"') AS created_at,
+		TO_CHAR(users.updated_at AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS"Z"') AS updated_at`
+
+// Repository handles user and session database operations.
+type Repository struct {
+	db *pgxpool.Pool
+}
+
+func NewRepository(db *pgxpool.Pool) *Repository {
+	return &Repository{db: db}
+}
+
+func (r *Repository) Create(ctx context.Context, u User, passwordHash string) (User, error) {
+	return scanUser(r.db.QueryRow(ctx, `
+		INSERT INTO users (email, name, password_hash, role)
+		VALUES ($1, $2, $3, $4)
+		RETURNING `+userColumns,
+		u.Email, u.Name, passwordHash, u.Role,
+	))
+}
+
+func (r *Repository) List(ctx context.Context) ([]User, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT `+userColumns+`
+		FROM users
+		ORDER BY email
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := make([]User, 0)
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+
+	return users, rows.Err()
+}
+
+func (r *Repository) GetByID(ctx context.Context, id int64) (User, error) {
+	return scanUser(r.db.QueryRow(ctx, `
+		SELECT `+userColumns+`
+		FROM users
+		WHERE id = $1
+	`, id))
+}
+
+// GetByEmail returns the user with the given (lowercased) email together with
+// its password hash.
+func (r *Repository) GetByEmail(ctx context.Context, email string) (User, string, error) {
+	var (
+		u            User
+		passwordHash string
+	)
+	err := r.db.QueryRow(ctx, `
+		SELECT `+userColumns+`, users.password_hash
+		FROM users
+		WHERE email = $1
+	`, email).Scan(
+		&u.ID,
+		&u.Email,
+		&u.Name,
+		&u.Role,
+		&u.Active,
+		&u.LastLoginAt,
+		&u.CreatedAt,
+		&u.UpdatedAt,
+		&passwordHash,
+	)
+	return u, passwordHash, err
+}
+
+// errLastAdmin is returned by SetActive when deactivating id would leave no
+// active admin.
+var errLastAdmin = errors.New("last active admin")
+
+// SetActive activates or deactivates a user. Deactivating also revokes the
+// user's sessions, and fails with errLastAdmin for the last active admin.
+func (r *Repository) SetActive(ctx context.Context, id int64, active bool) (User, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return User{}, err
+	}
+	defer tx.Rollback(ctx) //nolint:errcheck
+
+	if !active {
+		// The other admins are locked so two admins cannot deactivate each
+		// other at the same time.
+		var others int
+		var isActiveAdmin bool
+		if err := tx.QueryRow(ctx, `
+			SELECT
+				(SELECT COUNT(*) FROM (
+					SELECT 1 FROM users WHERE role = 'admin' AND active AND id <> $1 FOR UPDATE
+				) a),
+				EXISTS (SELECT 1 FROM users WHERE id = $1 AND role = 'admin' AND active)
+		`, id).Scan(&others, &isActiveAdmin); err != nil {
+			return User{}, err
+		}
+		if isActiveAdmin && others == 0 {
+			return User{}, errLastAdmin
+		}
+	}
+
+	u, err := scanUser(tx.QueryRow(ctx, `
+		UPDATE users
+		SET active = $2,
+			updated_at = NOW()
+		WHERE id = $1
+		RETURNING `+userColumns,
+		id, active,
+	))
+	if err != nil {
+		return User{}, err
+	}
+	if !active {
+		if _, err := tx.Exec(ctx, `
+			UPDATE user_sessions
+			SET revoked_at = NOW()
+			WHERE user_id = $1 AND revoked_at IS NULL
+		`, id); err != nil {
+			return User{}, err
+		}
+	}
+
+	return u, tx.Commit(ctx)
+}
+
+// CreateSession stores a session for userID, records the login and drops the
+// user's expired sessions. It returns when the session expires.
+func (r *Repository) CreateSession(ctx context.Context, userID int64, tokenHash string, ttl time.Duration) (string, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback(ctx) //nolint:errcheck
+
+	if _, err := tx.Exec(ctx, `
+		DELETE FROM user_sessions WHERE user_id = $1 AND expires_at <= NOW()
+	`, userID); err != nil {
+		return "", err
+	}
+
+	var expiresAt string
+	if err := tx.QueryRow(ctx, `
+		INSERT INTO user_sessions (user_id, token_hash, expires_at)
+		VALUES ($1, $2, NOW() + $3::BIGINT * INTERVAL '1 second')
+		RETURNING TO_CHAR(expires_at AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS"Z"')
+	`, userID, tokenHash, int64(ttl/time.Second)).Scan(&expiresAt); err != nil {
+		return "", err
+	}
+
+	if _, err := tx.Exec(ctx, `UPDATE users SET last_login_at = NOW() WHERE id = $1`, userID); err != nil {
+		return "", err
+	}
+
+	return expiresAt, tx.Commit(ctx)
+}
+
+// RotateSession replaces the refresh token of an unexpired, unrevoked session
+// owned by an active user, so every refresh token works once. It returns the
+// user and when the session expires; pgx.ErrNoRows is returned when no such
+// session exists.
+func (r *Repository) RotateSession(ctx context.Context, oldHash, newHash string) (User, string, error) {
+	var (
+		u         User
+		expiresAt string
+	)
+	err := r.db.QueryRow(ctx, `
+		UPDATE user_sessions s
+		SET token_hash = $2
+		FROM users
+		WHERE s.token_hash = $1
+			AND s.revoked_at IS NULL
+			AND s.expires_at > NOW()
+			AND users.id = s.user_id
+			AND users.active
+		RETURNING `+userColumns+`,
+			TO_CHAR(s.expires_at AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS"Z"')
+	`, oldHash, newHash).Scan(
+		&u.ID,
+		&u.Email,
+		&u.Name,
+		&u.Role,
+		&u.Active,
+		&u.LastLoginAt,
+		&u.CreatedAt,
+		&u.UpdatedAt,
+		&expiresAt,
+	)
+	return u, expiresAt, err
+}
+
+func (r *Repository) RevokeSession(ctx context.Context, tokenHash string) error {
+	_, err := r.db.Exec(ctx, `
+		UPDATE user_sessions
+		SET revoked_at = NOW()
+		WHERE token_hash = $1 AND revoked_at IS NULL
+	`, tokenHash)
+	return err
+}
+
+// ListSigningKeys returns the active signing key and the keys retired less
+// than retention ago, newest first.
+func (r *Repository) ListSigningKeys(ctx context.Context, retention time.Duration) ([]signingKey, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT kid, private_key, created_at, retired_at
+		FROM auth_signing_keys
+		WHERE retired_at IS NULL OR retired_at > NOW() - $1::BIGINT * INTERVAL '1 second'
+		ORDER BY created_at DESC
+	`, int64(retention/time.Second))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := make([]signingKey, 0)
+	for rows.Next() {
+		var (
+			k    signingKey
+			seed []byte
+		)
+		if err := rows.Scan(&k.ID, &seed, &k.CreatedAt, &k.RetiredAt); err != nil {
+			return nil, err
+		}
+		if len(seed) != ed25519.SeedSize {
+			return nil, fmt.Errorf("signing key %s has an invalid seed", k.ID)
+		}
+		k.PrivateKey = ed25519.NewKeyFromSeed(seed)
+		keys = append(keys, k)
+	}
+
+	return keys, rows.Err()
+}
+
+// AddSigningKey stores a new active signing key. With rotate it retires the
+// current active key and deletes keys retired more than retention ago;
+// without it nothing is stored when an active key already exists, which lets
+// every instance call it at startup.
+func (r *Repository) AddSigningKey(ctx context.Context, key signingKey, rotate bool, retention time.Duration) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx) //nolint:errcheck
+
+	// Serializes instances starting up or rotating at the same time.
+	if _, err := tx.Exec(ctx, `LOCK TABLE auth_signing_keys IN SHARE ROW EXCLUSIVE MODE`); err != nil {
+		return err
+	}
+
+	if !rotate {
+		var exists bool
+		if err := tx.QueryRow(ctx, `
+			SELECT EXISTS (SELECT 1 FROM auth_signing_keys WHERE retired_at IS NULL)
+		`).Scan(&exists); err != nil {
+			return err
+		}
+		if exists {
+			return tx.Commit(ctx)
+		}
+	}
+
+	if _, err := tx.Exec(ctx, `
+		DELETE FROM auth_signing_keys
+		WHERE retired_at <= NOW() - $1::BIGINT * INTERVAL '1 second'
+	`, int64(retention/time.Second)); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `
+		UPDATE auth_signing_keys SET retired_at = NOW() WHERE retired_at IS NULL
+	`); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO auth_signing_keys (kid, private_key) VALUES ($1, $2)
+	`, key.ID, []byte(key.PrivateKey.Seed())); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func scanUser(row pgx.Row) (User, error) {
+	var u User
+	err := row.Scan(
+		&u.ID,
+		&u.Email,
+		&u.Name,
+		&u.Role,
+		&u.Active,
+		&u.LastLoginAt,
+		&u.CreatedAt,
+		&u.UpdatedAt,
+	)
+	return u, err
+}
@@ -1,18 +1,411 @@
 package auth
 
-import "github.com/mhakimsaputra17/discount-voucher-management/backend/internal/common"
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/mail"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/mhakimsaputra17/discount-voucher-management/backend/internal/common"
+	"github.com/mhakimsaputra17/discount-voucher-management/backend/internal/config"
+	"github.com/mhakimsaputra17/discount-voucher-management/backend/internal/logger"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// keyReloadInterval is how often every instance reloads the signing keys,
+// so a key rotated on one instance is picked up by the others.
+const keyReloadInterval = time.Minute
+
+// minKeyReloadInterval limits the reloads triggered by tokens signed with an
+// unknown key.
+const minKeyReloadInterval = 10 * time.Second
 
 type Service struct {
-	token string
+	repo   *Repository
+	cfg    config.Config
+	logger *logger.Logger
+	keys   keyring
+}
+
+// NewService returns a Service without signing keys; call LoadSigningKeys
+// before issuing or verifying tokens.
+func NewService(repo *Repository, cfg config.Config, log *logger.Logger) *Service {
+	return &Service{repo: repo, cfg: cfg, logger: log}
+}
+
+// keyRetention is how long a retired key is still published and trusted:
+// long enough for every token it signed to expire, including tokens signed
+// by instances that have not reloaded the keys yet.
+func (s *Service) keyRetention() time.Duration {
+	return s.cfg.AccessTokenTTL + keyReloadInterval
+}
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     []byte
+)
+
+// compareDummyHash spends as long as a real password check, so a login for
+// an unknown email cannot be told apart by its response time.
+func compareDummyHash(password string) {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy-password-for-timing"), passwordHashCost)
+	})
+	_ = bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+}
+
+// CreateUser adds a staff account. Role defaults to staff.
+func (s *Service) CreateUser(ctx context.Context, input CreateUserInput) (User, *common.AppError) {
+	email, appErr := normalizeEmail(input.Email)
+	if appErr != nil {
+		return User{}, appErr
+	}
+	if appErr := validatePassword(input.Password); appErr != nil {
+		return User{}, appErr
+	}
+	role := input.Role
+	if role == "" {
+		role = RoleStaff
+	}
+	if role != RoleStaff && role != RoleAdmin {
+		return User{}, common.NewValidationError("role must be staff or admin", nil)
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(input.Password), passwordHashCost)
+	if err != nil {
+		return User{}, common.NewInternalError("failed to hash password", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.QueryTimeout)
+	defer cancel()
+
+	user, err := s.repo.Create(ctx, User{Email: email, Name: strings.TrimSpace(input.Name), Role: role}, string(hash))
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return User{}, common.NewConflictError("a user with this email already exists", err)
+		}
+		return User{}, common.NewInternalError("failed to create user", err)
+	}
+
+	return user, nil
+}
+
+func (s *Service) ListUsers(ctx context.Context) ([]User, *common.AppError) {
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.QueryTimeout)
+	defer cancel()
+
+	users, err := s.repo.List(ctx)
+	if err != nil {
+		return nil, common.NewInternalError("failed to list users", err)
+	}
+	return users, nil
+}
+
+// SetActive activates or deactivates a user. A deactivated user cannot log
+// in and its sessions are revoked at once. The last active admin cannot be
+// deactivated, so there is always someone able to manage accounts.
+func (s *Service) SetActive(ctx context.Context, id int64, active bool) (User, *common.AppError) {
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.QueryTimeout)
+	defer cancel()
+
+	user, err := s.repo.SetActive(ctx, id, active)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return User{}, common.NewNotFoundError("user not found", err)
+		}
+		if errors.Is(err, errLastAdmin) {
+			return User{}, common.NewConflictError("cannot deactivate the last active admin", err)
+		}
+		return User{}, common.NewInternalError("failed to update user", err)
+	}
+	return user, nil
+}
+
+// Login checks the credentials and starts a session. Unknown emails, wrong
+// passwords and deactivated users all get the same error.
+func (s *Service) Login(ctx context.Context, email, password string) (TokenResponse, *common.AppError) {
+	invalid := common.NewUnauthorizedError("invalid email or password", nil)
+
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.QueryTimeout)
+	defer cancel()
+
+	user, hash, err := s.repo.GetByEmail(ctx, strings.ToLower(strings.TrimSpace(email)))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			compareDummyHash(password)
+			return TokenResponse{}, invalid
+		}
+		return TokenResponse{}, common.NewInternalError("failed to fetch user", err)
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil || !user.Active {
+		return TokenResponse{}, invalid
+	}
+
+	refreshToken, err := newRefreshToken()
+	if err != nil {
+		return TokenResponse{}, common.NewInternalError("failed to create session", err)
+	}
+	expiresAt, err := s.repo.CreateSession(ctx, user.ID, hashToken(refreshToken), s.cfg.RefreshTokenTTL)
+	if err != nil {
+		return TokenResponse{}, common.NewInternalError("failed to create session", err)
+	}
+
+	return s.issue(user, refreshToken, expiresAt)
+}
+
+// Refresh exchanges a refresh token for a new access and refresh token. The
+// old refresh token stops working; the session keeps its original expiry.
+func (s *Service) Refresh(ctx context.Context, refreshToken string) (TokenResponse, *common.AppError) {
+	next, err := newRefreshToken()
+	if err != nil {
+		return TokenResponse{}, common.NewInternalError("failed to refresh session", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.QueryTimeout)
+	defer cancel()
+
+	user, expiresAt, err := s.repo.RotateSession(ctx, hashToken(refreshToken), hashToken(next))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return TokenResponse{}, common.NewUnauthorizedError("invalid refresh token", nil)
+		}
+		return TokenResponse{}, common.NewInternalError("failed to refresh session", err)
+	}
+
+	return s.issue(user, next, expiresAt)
+}
+
+// issue signs an access token for user and pairs it with refreshToken.
+func (s *Service) issue(user User, refreshToken, refreshExpiresAt string) (TokenResponse, *common.AppError) {
+	key, ok := s.keys.activeKey()
+	if !ok {
+		return TokenResponse{}, common.NewInternalError("no active signing key", nil)
+	}
+	jti, err := randomToken(16)
+	if err != nil {
+		return TokenResponse{}, common.NewInternalError("failed to sign access token", err)
+	}
+
+	now := time.Now()
+	accessToken, err := signJWT(key, Claims{
+		Issuer:    s.cfg.JWTIssuer,
+		Subject:   strconv.FormatInt(user.ID, 10),
+		Email:     user.Email,
+		Roles:     []string{user.Role},
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(s.cfg.AccessTokenTTL).Unix(),
+		ID:        jti,
+	})
+	if err != nil {
+		return TokenResponse{}, common.NewInternalError("failed to sign access token", err)
+	}
+
+	return TokenResponse{
+		AccessToken:      accessToken,
+		TokenType:        "Bearer",
+		ExpiresIn:        int64(s.cfg.AccessTokenTTL / time.Second),
+		RefreshToken:     refreshToken,
+		RefreshExpiresAt: refreshExpiresAt,
+		User:             user,
+	}, nil
+}
+
+// Authenticate verifies an access token locally, without touching the
+// database, and returns its claims. A deactivated user keeps access until
+// the token expires, at most ACCESS_TOKEN_TTL_MINUTES later.
+func (s *Service) Authenticate(ctx context.Context, token string) (Claims, *common.AppError) {
+	invalid := common.NewUnauthorizedError("invalid token", nil)
+
+	header, parts, err := parseJWT(token)
+	if err != nil {
+		return Claims{}, invalid
+	}
+	key, ok := s.keys.key(header.KeyID)
+	if !ok && !s.keys.loadedSince(minKeyReloadInterval) {
+		// The key may have been rotated by another instance.
+		if err := s.reloadKeys(ctx); err != nil {
+			return Claims{}, common.NewInternalError("failed to load signing keys", err)
+		}
+		key, ok = s.keys.key(header.KeyID)
+	}
+	if !ok {
+		return Claims{}, common.NewUnauthorizedError("invalid token", errUnknownKey)
+	}
+
+	claims, err := verifyJWT(key, parts)
+	if err != nil {
+		return Claims{}, common.NewUnauthorizedError("invalid token", err)
+	}
+	if claims.Issuer != s.cfg.JWTIssuer {
+		return Claims{}, invalid
+	}
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return Claims{}, common.NewUnauthorizedError("token expired", nil)
+	}
+	if _, err := strconv.ParseInt(claims.Subject, 10, 64); err != nil {
+		return Claims{}, invalid
+	}
+
+	return claims, nil
+}
+
+// Logout revokes the session a refresh token belongs to. Access tokens
+// already issued stay valid until they expire.
+func (s *Service) Logout(ctx context.Context, refreshToken string) *common.AppError {
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.QueryTimeout)
+	defer cancel()
+
+	if err := s.repo.RevokeSession(ctx, hashToken(refreshToken)); err != nil {
+		return common.NewInternalError("failed to revoke session", err)
+	}
+	return nil
+}
+
+// Me returns the user an access token was issued to.
+func (s *Service) Me(ctx context.Context, claims Claims) (User, *common.AppError) {
+	id, err := strconv.ParseInt(claims.Subject, 10, 64)
+	if err != nil {
+		return User{}, common.NewUnauthorizedError("invalid token", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.QueryTimeout)
+	defer cancel()
+
+	user, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return User{}, common.NewNotFoundError("user not found", err)
+		}
+		return User{}, common.NewInternalError("failed to fetch user", err)
+	}
+	return user, nil
+}
+
+// LoadSigningKeys creates the first signing key if there is none and loads
+// the keys. It must be called before the service issues or verifies tokens.
+func (s *Service) LoadSigningKeys(ctx context.Context) error {
+	key, err := newSigningKey()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.QueryTimeout)
+	defer cancel()
+
+	if err := s.repo.AddSigningKey(ctx, key, false, s.keyRetention()); err != nil {
+		return err
+	}
+	return s.reloadKeys(ctx)
+}
+
+// RotateSigningKey replaces the active signing key. The old key stays in
+// the JWKS until every token it signed has expired.
+func (s *Service) RotateSigningKey(ctx context.Context) (JWKSet, *common.AppError) {
+	key, err := newSigningKey()
+	if err != nil {
+		return JWKSet{}, common.NewInternalError("failed to generate signing key", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.QueryTimeout)
+	defer cancel()
+
+	if err := s.repo.AddSigningKey(ctx, key, true, s.keyRetention()); err != nil {
+		return JWKSet{}, common.NewInternalError("failed to store signing key", err)
+	}
+	if err := s.reloadKeys(ctx); err != nil {
+		return JWKSet{}, common.NewInternalError("failed to load signing keys", err)
+	}
+
+	s.logger.Infof("rotated access token signing key, new kid %s", key.ID)
+	return s.keys.jwks(), nil
+}
+
+// JWKS returns the public keys access tokens can be verified with.
+func (s *Service) JWKS() JWKSet {
+	return s.keys.jwks()
+}
+
+// RunKeyReloader reloads the signing keys every keyReloadInterval until ctx
+// is done.
+func (s *Service) RunKeyReloader(ctx context.Context) {
+	ticker := time.NewTicker(keyReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reloadCtx, cancel := context.WithTimeout(ctx, s.cfg.QueryTimeout)
+			err := s.reloadKeys(reloadCtx)
+			cancel()
+			if err != nil {
+				s.logger.Errorf("failed to reload signing keys: %v", err)
+			}
+		}
+	}
+}
+
+func (s *Service) reloadKeys(ctx context.Context) error {
+	keys, err := s.repo.ListSigningKeys(ctx, s.keyRetention())
+	if err != nil {
+		return err
+	}
+	s.keys.set(keys)
+	return nil
 }
 
-func NewService(token string) *Service {
-	return &Service{token: token}
+func newSigningKey() (signingKey, error) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return signingKey{}, err
+	}
+	return signingKey{ID: keyID(public), PrivateKey: private}, nil
+}
+
+func normalizeEmail(raw string) (string, *common.AppError) {
+	email := strings.ToLower(strings.TrimSpace(raw))
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return "", common.NewValidationError("email must be a valid email address", err)
+	}
+	return email, nil
 }
 
-func (s *Service) ValidateToken(token string) *common.AppError {
-	if token != s.token {
-		return common.NewUnauthorizedError("invalid token", nil)
+func validatePassword(password string) *common.AppError {
+	if len(password) < minPasswordLength || len(password) > maxPasswordLength {
+		return common.NewValidationError(fmt.Sprintf("password must be %d to %d bytes long", minPasswordLength, maxPasswordLength), nil)
 	}
 	return nil
 }
+
+func newRefreshToken() (string, error) {
+	return randomToken(refreshTokenBytes)
+}
+
+func randomToken(size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken returns the hex SHA-256 of a refresh token, the form stored in
+// user_sessions.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
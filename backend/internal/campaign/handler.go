@@ -0,0 +1,142 @@
+package campaign
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mhakimsaputra17/discount-voucher-management/backend/internal/common"
+	"github.com/mhakimsaputra17/discount-voucher-management/backend/internal/http/response"
+)
+
+type Handler struct {
+	service *Service
+}
+
+func NewHandler(service *Service) *Handler {
+	return &Handler{service: service}
+}
+
+func (h *Handler) List(c *gin.Context) {
+	limit := parseQueryInt(c, "limit", 10)
+	page := parseQueryInt(c, "page", 1)
+	if page < 1 {
+		page = 1
+	}
+	if limit <= 0 {
+		limit = 10
+	}
+	if limit > 100 {
+		limit = 100
+	}
+
+	params := ListParams{
+		Search: c.Query("q"),
+		Limit:  int32(limit),
+		Offset: int32((page - 1) * limit),
+	}
+
+	result, appErr := h.service.List(c.Request.Context(), params)
+	if appErr != nil {
+		response.Error(c, appErr)
+		return
+	}
+
+	response.Success(c, http.StatusOK, result)
+}
+
+func (h *Handler) Create(c *gin.Context) {
+	var input CreateCampaignInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		response.Error(c, validationError(err))
+		return
+	}
+
+	created, appErr := h.service.Create(c.Request.Context(), input)
+	if appErr != nil {
+		response.Error(c, appErr)
+		return
+	}
+
+	response.Success(c, http.StatusCreated, created)
+}
+
+func (h *Handler) Get(c *gin.Context) {
+	id, appErr := parseIDParam(c)
+	if appErr != nil {
+		response.Error(c, appErr)
+		return
+	}
+
+	campaign, err := h.service.Get(c.Request.Context(), id)
+	if err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	response.Success(c, http.StatusOK, campaign)
+}
+
+func (h *Handler) Update(c *gin.Context) {
+	id, appErr := parseIDParam(c)
+	if appErr != nil {
+		response.Error(c, appErr)
+		return
+	}
+
+	var input UpdateCampaignInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		response.Error(c, validationError(err))
+		return
+	}
+
+	updated, err := h.service.Update(c.Request.Context(), id, input)
+	if err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	response.Success(c, http.StatusOK, updated)
+}
+
+func (h *Handler) Delete(c *gin.Context) {
+	id, appErr := parseIDParam(c)
+	if appErr != nil {
+		response.Error(c, appErr)
+		return
+	}
+
+	if err := h.service.Delete(c.Request.Context(), id); err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func parseQueryInt(c *gin.Context, key string, fallback int) int {
+	valueStr := c.Query(key)
+	if valueStr == "" {
+		return fallback
+	}
+
+	value, err := strconv.Atoi(valueStr)
+	if err != nil {
+		return fallback
+	}
+
+	return value
+}
+
+func parseIDParam(c *gin.Context) (int64, *common.AppError) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil || id <= 0 {
+		return 0, common.NewValidationError("invalid campaign id", err)
+	}
+	return id, nil
+}
+
+func validationError(err error) *common.AppError {
+	return common.NewValidationError("invalid request payload", err)
+}
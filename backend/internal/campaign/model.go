@@ -0,0 +1,46 @@
+package campaign
+
+const (
+	discountTypePercent     = "percent"
+	discountTypeFixedAmount = "fixed_amount"
+)
+
+// Campaign groups vouchers and carries optional defaults that are copied onto
+// vouchers created inside it. A nil default means the voucher must supply the
+// value itself. CheckDigit makes codes generated for the campaign carry a
+// check character.
+type Campaign struct {
+	ID                int64   `json:"id" db:"id"`
+	Name              string  `json:"name" db:"name"`
+	Description       string  `json:"description" db:"description"`
+	DiscountType      *string `json:"discount_type" db:"discount_type"`
+	DiscountPercent   *int    `json:"discount_percent" db:"discount_percent"`
+	DiscountAmount    *int64  `json:"discount_amount" db:"discount_amount"`
+	Currency          *string `json:"currency" db:"currency"`
+	MinOrderAmount    *int64  `json:"min_order_amount" db:"min_order_amount"`
+	MaxDiscountAmount *int64  `json:"max_discount_amount" db:"max_discount_amount"`
+	ValidFrom         *string `json:"valid_from" db:"valid_from"`
+	ExpiryDate        *string `json:"expiry_date" db:"expiry_date"`
+	CheckDigit        bool    `json:"check_digit" db:"check_digit"`
+	VoucherCount      int     `json:"voucher_count" db:"voucher_count"`
+	CreatedAt         string  `json:"created_at" db:"created_at"`
+	UpdatedAt         string  `json:"updated_at" db:"updated_at"`
+}
+
+type ListParams struct {
+	Search string
+	Limit  int32
+	Offset int32
+}
+
+type PaginationMeta struct {
+	Page       int `json:"page"`
+	Limit      int `json:"limit"`
+	Total      int `json:"total"`
+	TotalPages int `json:"total_pages"`
+}
+
+type ListResponse struct {
+	Data       []Campaign     `json:"data"`
+	Pagination PaginationMeta `json:"pagination"`
+}
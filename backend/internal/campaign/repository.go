@@ -0,0 +1,245 @@
+package campaign
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/mhakimsaputra17/discount-voucher-management/backend/internal/audit"
+)
+
+// campaignColumns is the select list shared by every query that returns a
+// Campaign; keep it in sync with scanCampaign.
+const campaignColumns = `id,
+		name,
+		description,
+		discount_type,
+		discount_percent,
+		discount_amount,
+		currency,
+		min_order_amount,
+		max_discount_amount,
+		TO_CHAR(valid_from, 'YYYY-MM-DD') AS valid_from,
+		TO_CHAR(expiry_date, 'YYYY-MM-DD') AS expiry_date,
+		check_digit,
+		(SELECT COUNT(*) FROM vouchers v WHERE v.campaign_id = campaigns.id AND v.deleted_at IS NULL) AS voucher_count,
+		TO_CHAR(created_at AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS"Z"') AS created_at,
+		TO_CHAR(updated_at AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS"Z"') AS updated_at`
+
+// Repository handles campaign database operations.
+type Repository struct {
+	db *pgxpool.Pool
+}
+
+func NewRepository(db *pgxpool.Pool) *Repository {
+	return &Repository{db: db}
+}
+
+func (r *Repository) List(ctx context.Context, params ListParams) ([]Campaign, int, error) {
+	args := []any{}
+	whereClauses := []string{"1=1"}
+
+	if params.Search != "" {
+		placeholder := len(args) + 1
+		whereClauses = append(whereClauses, fmt.Sprintf("name ILIKE $%d", placeholder))
+		args = append(args, fmt.Sprintf("%%%s%%", params.Search))
+	}
+
+	limitPlaceholder := len(args) + 1
+	offsetPlaceholder := limitPlaceholder + 1
+
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM campaigns
+		WHERE %s
+		ORDER BY created_at DESC, id DESC
+		LIMIT $%d OFFSET $%d
+	`, campaignColumns, strings.Join(whereClauses, " AND "), limitPlaceholder, offsetPlaceholder)
+
+	argsWithLimit := append(args, params.Limit, params.Offset)
+
+	rows, err := r.db.Query(ctx, query, argsWithLimit...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var campaigns []Campaign
+	for rows.Next() {
+		c, err := scanCampaign(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		campaigns = append(campaigns, c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	countQuery := fmt.Sprintf(`
+		SELECT COUNT(*)
+		FROM campaigns
+		WHERE %s
+	`, strings.Join(whereClauses, " AND "))
+
+	var total int
+	if err := r.db.QueryRow(ctx, countQuery, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	return campaigns, total, nil
+}
+
+func (r *Repository) GetByID(ctx context.Context, id int64) (Campaign, error) {
+	return scanCampaign(r.db.QueryRow(ctx, `
+		SELECT `+campaignColumns+`
+		FROM campaigns
+		WHERE id = $1
+	`, id))
+}
+
+func (r *Repository) Create(ctx context.Context, c Campaign) (Campaign, error) {
+	return scanCampaign(r.db.QueryRow(ctx, `
+		INSERT INTO campaigns (
+			name,
+			description,
+			discount_type,
+			discount_percent,
+			discount_amount,
+			currency,
+			min_order_amount,
+			max_discount_amount,
+			valid_from,
+			expiry_date,
+			check_digit
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9::DATE, $10::DATE, $11)
+		RETURNING `+campaignColumns,
+		c.Name,
+		c.Description,
+		c.DiscountType,
+		c.DiscountPercent,
+		c.DiscountAmount,
+		c.Currency,
+		c.MinOrderAmount,
+		c.MaxDiscountAmount,
+		c.ValidFrom,
+		c.ExpiryDate,
+		c.CheckDigit,
+	))
+}
+
+func (r *Repository) Update(ctx context.Context, id int64, c Campaign) (Campaign, error) {
+	return scanCampaign(r.db.QueryRow(ctx, `
+		UPDATE campaigns
+		SET name = $1,
+			description = $2,
+			discount_type = $3,
+			discount_percent = $4,
+			discount_amount = $5,
+			currency = $6,
+			min_order_amount = $7,
+			max_discount_amount = $8,
+			valid_from = $9::DATE,
+			expiry_date = $10::DATE,
+			check_digit = $11,
+			updated_at = NOW()
+		WHERE id = $12
+		RETURNING `+campaignColumns,
+		c.Name,
+		c.Description,
+		c.DiscountType,
+		c.DiscountPercent,
+		c.DiscountAmount,
+		c.Currency,
+		c.MinOrderAmount,
+		c.MaxDiscountAmount,
+		c.ValidFrom,
+		c.ExpiryDate,
+		c.CheckDigit,
+		id,
+	))
+}
+
+// Delete removes a campaign. Its vouchers are kept and simply lose their
+// campaign_id, which is recorded in the audit log of each of them. Detaching
+// does not bump their version (see migrations/025_voucher_version_fk_changes.sql).
+func (r *Repository) Delete(ctx context.Context, id int64) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx) //nolint:errcheck
+
+	// Locking the campaign keeps vouchers from being attached to it until it
+	// is gone, so every voucher it loses is audited below.
+	var exists int
+	if err := tx.QueryRow(ctx, `SELECT 1 FROM campaigns WHERE id = $1 FOR UPDATE`, id).Scan(&exists); err != nil {
+		return err
+	}
+
+	rows, err := tx.Query(ctx, `
+		UPDATE vouchers
+		SET campaign_id = NULL
+		WHERE campaign_id = $1
+		RETURNING id
+	`, id)
+	if err != nil {
+		return err
+	}
+	var voucherIDs []int64
+	for rows.Next() {
+		var voucherID int64
+		if err := rows.Scan(&voucherID); err != nil {
+			rows.Close()
+			return err
+		}
+		voucherIDs = append(voucherIDs, voucherID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	entries := make([]audit.Entry, len(voucherIDs))
+	for i, voucherID := range voucherIDs {
+		entries[i], err = audit.NewEntry(ctx, voucherID, audit.ActionUpdate,
+			map[string]any{"campaign_id": id}, map[string]any{"campaign_id": nil})
+		if err != nil {
+			return err
+		}
+	}
+	if err := audit.Insert(ctx, tx, entries...); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM campaigns WHERE id = $1`, id); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func scanCampaign(row pgx.Row) (Campaign, error) {
+	var c Campaign
+	err := row.Scan(
+		&c.ID,
+		&c.Name,
+		&c.Description,
+		&c.DiscountType,
+		&c.DiscountPercent,
+		&c.DiscountAmount,
+		&c.Currency,
+		&c.MinOrderAmount,
+		&c.MaxDiscountAmount,
+		&c.ValidFrom,
+		&c.ExpiryDate,
+		&c.CheckDigit,
+		&c.VoucherCount,
+		&c.CreatedAt,
+		&c.UpdatedAt,
+	)
+	return c, err
+}
@@ -0,0 +1,248 @@
+package campaign
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/mhakimsaputra17/discount-voucher-management/backend/internal/common"
+	"github.com/mhakimsaputra17/discount-voucher-management/backend/internal/config"
+)
+
+type Service struct {
+	repo *Repository
+	cfg  config.Config
+}
+
+type CreateCampaignInput struct {
+	Name              string  `json:"name" binding:"required"`
+	Description       string  `json:"description"`
+	DiscountType      *string `json:"discount_type" binding:"omitempty,oneof=percent fixed_amount"`
+	DiscountPercent   *int    `json:"discount_percent" binding:"omitempty,min=1,max=100"`
+	DiscountAmount    *int64  `json:"discount_amount" binding:"omitempty,min=1"`
+	Currency          *string `json:"currency" binding:"omitempty,len=3"`
+	MinOrderAmount    *int64  `json:"min_order_amount" binding:"omitempty,min=1"`
+	MaxDiscountAmount *int64  `json:"max_discount_amount" binding:"omitempty,min=1"`
+	ValidFrom         *string `json:"valid_from"`
+	ExpiryDate        *string `json:"expiry_date"`
+	CheckDigit        bool    `json:"check_digit"`
+}
+
+type UpdateCampaignInput struct {
+	Name              string  `json:"name" binding:"required"`
+	Description       string  `json:"description"`
+	DiscountType      *string `json:"discount_type" binding:"omitempty,oneof=percent fixed_amount"`
+	DiscountPercent   *int    `json:"discount_percent" binding:"omitempty,min=1,max=100"`
+	DiscountAmount    *int64  `json:"discount_amount" binding:"omitempty,min=1"`
+	Currency          *string `json:"currency" binding:"omitempty,len=3"`
+	MinOrderAmount    *int64  `json:"min_order_amount" binding:"omitempty,min=1"`
+	MaxDiscountAmount *int64  `json:"max_discount_amount" binding:"omitempty,min=1"`
+	ValidFrom         *string `json:"valid_from"`
+	ExpiryDate        *string `json:"expiry_date"`
+	CheckDigit        bool    `json:"check_digit"`
+}
+
+func NewService(repo *Repository, cfg config.Config) *Service {
+	return &Service{repo: repo, cfg: cfg}
+}
+
+func (in CreateCampaignInput) toCampaign() Campaign {
+	return Campaign{
+		Name:              in.Name,
+		Description:       in.Description,
+		DiscountType:      in.DiscountType,
+		DiscountPercent:   in.DiscountPercent,
+		DiscountAmount:    in.DiscountAmount,
+		Currency:          in.Currency,
+		MinOrderAmount:    in.MinOrderAmount,
+		MaxDiscountAmount: in.MaxDiscountAmount,
+		ValidFrom:         in.ValidFrom,
+		ExpiryDate:        in.ExpiryDate,
+		CheckDigit:        in.CheckDigit,
+	}
+}
+
+func (in UpdateCampaignInput) toCampaign() Campaign {
+	return Campaign{
+		Name:              in.Name,
+		Description:       in.Description,
+		DiscountType:      in.DiscountType,
+		DiscountPercent:   in.DiscountPercent,
+		DiscountAmount:    in.DiscountAmount,
+		Currency:          in.Currency,
+		MinOrderAmount:    in.MinOrderAmount,
+		MaxDiscountAmount: in.MaxDiscountAmount,
+		ValidFrom:         in.ValidFrom,
+		ExpiryDate:        in.ExpiryDate,
+		CheckDigit:        in.CheckDigit,
+	}
+}
+
+func (s *Service) List(ctx context.Context, params ListParams) (ListResponse, *common.AppError) {
+	limit := params.Limit
+	if limit <= 0 {
+		limit = 10
+	}
+	params.Limit = limit
+
+	if params.Offset < 0 {
+		params.Offset = 0
+	}
+
+	page := int(params.Offset/limit) + 1
+
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.QueryTimeout)
+	defer cancel()
+
+	campaigns, total, err := s.repo.List(ctx, params)
+	if err != nil {
+		return ListResponse{}, common.NewInternalError("failed to list campaigns", err)
+	}
+	if campaigns == nil {
+		campaigns = make([]Campaign, 0)
+	}
+
+	totalPages := (total + int(limit) - 1) / int(limit)
+
+	return ListResponse{
+		Data: campaigns,
+		Pagination: PaginationMeta{
+			Page:       page,
+			Limit:      int(limit),
+			Total:      total,
+			TotalPages: totalPages,
+		},
+	}, nil
+}
+
+func (s *Service) Create(ctx context.Context, input CreateCampaignInput) (Campaign, *common.AppError) {
+	c := input.toCampaign()
+	if appErr := prepareCampaign(&c); appErr != nil {
+		return Campaign{}, appErr
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.QueryTimeout)
+	defer cancel()
+
+	created, err := s.repo.Create(ctx, c)
+	if err != nil {
+		return Campaign{}, handlePgxError(err)
+	}
+
+	return created, nil
+}
+
+func (s *Service) Get(ctx context.Context, id int64) (Campaign, *common.AppError) {
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.QueryTimeout)
+	defer cancel()
+
+	campaign, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Campaign{}, common.NewNotFoundError("campaign not found", err)
+		}
+		return Campaign{}, common.NewInternalError("failed to fetch campaign", err)
+	}
+
+	return campaign, nil
+}
+
+func (s *Service) Update(ctx context.Context, id int64, input UpdateCampaignInput) (Campaign, *common.AppError) {
+	c := input.toCampaign()
+	if appErr := prepareCampaign(&c); appErr != nil {
+		return Campaign{}, appErr
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.QueryTimeout)
+	defer cancel()
+
+	updated, err := s.repo.Update(ctx, id, c)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Campaign{}, common.NewNotFoundError("campaign not found", err)
+		}
+		return Campaign{}, handlePgxError(err)
+	}
+
+	return updated, nil
+}
+
+func (s *Service) Delete(ctx context.Context, id int64) *common.AppError {
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.QueryTimeout)
+	defer cancel()
+
+	err := s.repo.Delete(ctx, id)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return common.NewNotFoundError("campaign not found", err)
+		}
+		return common.NewInternalError("failed to delete campaign", err)
+	}
+
+	return nil
+}
+
+// prepareCampaign normalizes and validates campaign defaults. Defaults are
+// optional, but any that are set must describe a voucher the voucher service
+// would accept.
+func prepareCampaign(c *Campaign) *common.AppError {
+	c.Name = strings.TrimSpace(c.Name)
+	c.Description = strings.TrimSpace(c.Description)
+	if c.Name == "" {
+		return common.NewValidationError("name is required", nil)
+	}
+
+	if c.Currency != nil {
+		currency := strings.ToUpper(strings.TrimSpace(*c.Currency))
+		c.Currency = &currency
+	}
+
+	switch {
+	case c.DiscountType == nil:
+		if c.DiscountPercent != nil || c.DiscountAmount != nil {
+			return common.NewValidationError("discount_type is required when a default discount is set", nil)
+		}
+	case *c.DiscountType == discountTypePercent:
+		if c.DiscountPercent == nil || c.DiscountAmount != nil {
+			return common.NewValidationError("percent campaigns require discount_percent and no discount_amount", nil)
+		}
+	case *c.DiscountType == discountTypeFixedAmount:
+		if c.DiscountAmount == nil || c.DiscountPercent != nil {
+			return common.NewValidationError("fixed_amount campaigns require discount_amount and no discount_percent", nil)
+		}
+	default:
+		return common.NewValidationError("discount_type must be percent or fixed_amount", nil)
+	}
+
+	if c.ValidFrom != nil {
+		if _, err := time.Parse("2006-01-02", *c.ValidFrom); err != nil {
+			return common.NewValidationError("valid_from must be in YYYY-MM-DD format", err)
+		}
+	}
+	if c.ExpiryDate != nil {
+		if _, err := time.Parse("2006-01-02", *c.ExpiryDate); err != nil {
+			return common.NewValidationError("expiry_date must be in YYYY-MM-DD format", err)
+		}
+	}
+	if c.ValidFrom != nil && c.ExpiryDate != nil && *c.ValidFrom > *c.ExpiryDate {
+		return common.NewValidationError("valid_from must not be after expiry_date", nil)
+	}
+
+	return nil
+}
+
+func handlePgxError(err error) *common.AppError {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case "23505":
+			return common.NewConflictError("campaign name already exists", err)
+		case "23514":
+			return common.NewValidationError("invalid campaign defaults", err)
+		}
+	}
+	return common.NewInternalError("database error", err)
+}
@@ -0,0 +1,81 @@
+package codes
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrInvalidCheckDigit is returned by Format.Verify when a code does not
+// carry a valid check character, which almost always means it was mistyped.
+var ErrInvalidCheckDigit = errors.New("invalid check character")
+
+// CheckChar computes the Luhn mod N check character for body over alphabet,
+// where N is the alphabet size. It catches every single-character error and
+// most transpositions of adjacent characters.
+func CheckChar(body, alphabet string) (byte, error) {
+	n := len(alphabet)
+	sum := 0
+	factor := 2
+	for i := len(body) - 1; i >= 0; i-- {
+		idx := strings.IndexByte(alphabet, body[i])
+		if idx < 0 {
+			return 0, ErrInvalidCheckDigit
+		}
+		addend := factor * idx
+		if factor == 2 {
+			factor = 1
+		} else {
+			factor = 2
+		}
+		sum += addend/n + addend%n
+	}
+	return alphabet[(n-sum%n)%n], nil
+}
+
+// ValidCheck reports whether the last character of body is the Luhn mod N
+// check character of the rest.
+func ValidCheck(body, alphabet string) bool {
+	if len(body) < 2 {
+		return false
+	}
+	check, err := CheckChar(body[:len(body)-1], alphabet)
+	if err != nil {
+		return false
+	}
+	return body[len(body)-1] == check
+}
+
+// Format identifies a family of check-digit codes: every code starting with
+// Prefix carries a check character computed over the rest of the code using
+// the named Charset.
+type Format struct {
+	Prefix  string
+	Charset string
+}
+
+// Verify returns ErrInvalidCheckDigit unless code starts with f.Prefix and
+// ends with the correct check character.
+func (f Format) Verify(code string) error {
+	alphabet, ok := Alphabet(f.Charset)
+	if !ok || !strings.HasPrefix(code, f.Prefix) {
+		return ErrInvalidCheckDigit
+	}
+	if !ValidCheck(code[len(f.Prefix):], alphabet) {
+		return ErrInvalidCheckDigit
+	}
+	return nil
+}
+
+// Match returns the format with the longest prefix that code starts with.
+func Match(formats []Format, code string) (Format, bool) {
+	var (
+		best  Format
+		found bool
+	)
+	for _, f := range formats {
+		if strings.HasPrefix(code, f.Prefix) && (!found || len(f.Prefix) > len(best.Prefix)) {
+			best, found = f, true
+		}
+	}
+	return best, found
+}
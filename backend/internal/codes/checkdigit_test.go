@@ -0,0 +1,178 @@
+package codes
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheckCharKnownValues(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		charset string
+		want    byte
+	}{
+		// Luhn mod 10 over digits is the classic Luhn algorithm.
+		{"luhn example", "7992739871", CharsetDigits, '3'},
+		{"single digit", "5", CharsetDigits, '9'},
+		{"zero", "0", CharsetDigits, '0'},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			alphabet, _ := Alphabet(tt.charset)
+			got, err := CheckChar(tt.body, alphabet)
+			if err != nil {
+				t.Fatalf("CheckChar(%q) error: %v", tt.body, err)
+			}
+			if got != tt.want {
+				t.Fatalf("CheckChar(%q) = %q, want %q", tt.body, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckCharRejectsForeignCharacter(t *testing.T) {
+	alphabet, _ := Alphabet(CharsetAlphanumeric)
+	// O and 0 are left out of the alphanumeric charset.
+	for _, body := range []string{"ABC0", "OABC", "abc"} {
+		if _, err := CheckChar(body, alphabet); !errors.Is(err, ErrInvalidCheckDigit) {
+			t.Errorf("CheckChar(%q) error = %v, want ErrInvalidCheckDigit", body, err)
+		}
+	}
+}
+
+func TestValidCheckDetectsSingleSubstitution(t *testing.T) {
+	bodies := map[string]string{
+		CharsetAlphanumeric: "K7M2QX9H",
+		CharsetLetters:      "QWERTYUP",
+		CharsetDigits:       "40128888",
+	}
+	for charset, body := range bodies {
+		t.Run(charset, func(t *testing.T) {
+			alphabet, _ := Alphabet(charset)
+			check, err := CheckChar(body, alphabet)
+			if err != nil {
+				t.Fatal(err)
+			}
+			code := body + string(check)
+			if !ValidCheck(code, alphabet) {
+				t.Fatalf("ValidCheck(%q) = false for a freshly computed code", code)
+			}
+
+			for i := 0; i < len(code); i++ {
+				for j := 0; j < len(alphabet); j++ {
+					if alphabet[j] == code[i] {
+						continue
+					}
+					typo := []byte(code)
+					typo[i] = alphabet[j]
+					if ValidCheck(string(typo), alphabet) {
+						t.Errorf("ValidCheck(%q) = true, substitution at %d of %q not detected", typo, i, code)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestValidCheckDetectsAdjacentTransposition(t *testing.T) {
+	for _, charset := range []string{CharsetAlphanumeric, CharsetLetters, CharsetDigits} {
+		t.Run(charset, func(t *testing.T) {
+			alphabet, _ := Alphabet(charset)
+			first, last := alphabet[0], alphabet[len(alphabet)-1]
+
+			// Every pair of distinct characters, swapped in both positions
+			// relative to the check character's weighting.
+			for _, prefix := range []string{"", string(alphabet[1])} {
+				for a := 0; a < len(alphabet); a++ {
+					for b := 0; b < len(alphabet); b++ {
+						if a == b {
+							continue
+						}
+						x, y := alphabet[a], alphabet[b]
+						body := prefix + string([]byte{x, y})
+						check, err := CheckChar(body, alphabet)
+						if err != nil {
+							t.Fatal(err)
+						}
+						swapped := prefix + string([]byte{y, x}) + string(check)
+						detected := !ValidCheck(swapped, alphabet)
+
+						// Like 09 <-> 90 in decimal Luhn, swapping the first
+						// and last characters of the alphabet is the one
+						// transposition Luhn mod N cannot see.
+						blind := (x == first && y == last) || (x == last && y == first)
+						if detected == blind {
+							t.Errorf("transposition %q -> %q: detected = %v, want %v", body, swapped[:len(body)], detected, !blind)
+						}
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestFormatVerify(t *testing.T) {
+	digits, _ := Alphabet(CharsetDigits)
+	check, _ := CheckChar("7992739871", digits)
+	valid := "GIFT-7992739871" + string(check)
+
+	f := Format{Prefix: "GIFT-", Charset: CharsetDigits}
+	tests := []struct {
+		name   string
+		format Format
+		code   string
+		ok     bool
+	}{
+		{"valid", f, valid, true},
+		{"wrong check", f, "GIFT-79927398710", false},
+		{"missing prefix", f, valid[len("GIFT-"):], false},
+		{"other prefix", f, "CARD-" + valid[len("GIFT-"):], false},
+		{"prefix only", f, "GIFT-", false},
+		{"unknown charset", Format{Prefix: "GIFT-", Charset: "hex"}, valid, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.format.Verify(tt.code)
+			if tt.ok && err != nil {
+				t.Fatalf("Verify(%q) = %v, want nil", tt.code, err)
+			}
+			if !tt.ok && !errors.Is(err, ErrInvalidCheckDigit) {
+				t.Fatalf("Verify(%q) = %v, want ErrInvalidCheckDigit", tt.code, err)
+			}
+		})
+	}
+}
+
+func TestMatchPrefixRegistry(t *testing.T) {
+	registry := []Format{
+		{Prefix: "GIFT", Charset: CharsetDigits},
+		{Prefix: "GIFT-VIP", Charset: CharsetLetters},
+		{Prefix: "SALE", Charset: CharsetAlphanumeric},
+	}
+	tests := []struct {
+		code       string
+		wantPrefix string
+		wantFound  bool
+	}{
+		{"GIFT12345", "GIFT", true},
+		{"GIFT-VIPABCD", "GIFT-VIP", true},
+		{"GIFT-VI123", "GIFT", true},
+		{"SALE9X", "SALE", true},
+		{"PROMO1", "", false},
+		{"gift12345", "", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			got, found := Match(registry, tt.code)
+			if found != tt.wantFound || got.Prefix != tt.wantPrefix {
+				t.Fatalf("Match(%q) = (%q, %v), want (%q, %v)", tt.code, got.Prefix, found, tt.wantPrefix, tt.wantFound)
+			}
+		})
+	}
+
+	if _, found := Match(nil, "GIFT1"); found {
+		t.Fatal("Match on an empty registry found a format")
+	}
+}
@@ -0,0 +1,104 @@
+// Package codes generates random voucher codes.
+package codes
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+)
+
+// Charsets leave out characters that are easy to misread when a code is
+// printed or typed by hand: 0/O, 1/I/L and 2/Z in mixed codes, I/O among
+// letters. Every alphabet has an even size, which Luhn mod N needs to catch
+// all single-character typos.
+const (
+	CharsetAlphanumeric = "alphanumeric"
+	CharsetLetters      = "letters"
+	CharsetDigits       = "digits"
+)
+
+var charsets = map[string]string{
+	CharsetAlphanumeric: "ABCDEFGHJKMNPQRSTUVWXY23456789",
+	CharsetLetters:      "ABCDEFGHJKLMNPQRSTUVWXYZ",
+	CharsetDigits:       "0123456789",
+}
+
+// Alphabet returns the characters of a named charset.
+func Alphabet(charset string) (string, bool) {
+	alphabet, ok := charsets[charset]
+	return alphabet, ok
+}
+
+// Generator produces codes of the form prefix + length random characters
+// drawn from alphabet, optionally followed by a check character.
+type Generator struct {
+	prefix     string
+	alphabet   string
+	length     int
+	checkDigit bool
+}
+
+func NewGenerator(prefix, charset string, length int, checkDigit bool) (*Generator, error) {
+	alphabet, ok := Alphabet(charset)
+	if !ok {
+		return nil, fmt.Errorf("unknown charset %q", charset)
+	}
+	if length < 1 {
+		return nil, errors.New("code length must be positive")
+	}
+	return &Generator{prefix: prefix, alphabet: alphabet, length: length, checkDigit: checkDigit}, nil
+}
+
+// Space returns the number of distinct codes the generator can produce.
+func (g *Generator) Space() float64 {
+	return math.Pow(float64(len(g.alphabet)), float64(g.length))
+}
+
+// Next returns a single random code.
+func (g *Generator) Next() (string, error) {
+	max := big.NewInt(int64(len(g.alphabet)))
+	buf := make([]byte, len(g.prefix)+g.length, len(g.prefix)+g.length+1)
+	copy(buf, g.prefix)
+	for i := len(g.prefix); i < len(buf); i++ {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		buf[i] = g.alphabet[n.Int64()]
+	}
+	if g.checkDigit {
+		check, err := CheckChar(string(buf[len(g.prefix):]), g.alphabet)
+		if err != nil {
+			return "", err
+		}
+		buf = append(buf, check)
+	}
+	return string(buf), nil
+}
+
+// Batch returns n distinct codes that are not in exclude and for which skip,
+// if non-nil, returns false.
+func (g *Generator) Batch(n int, exclude map[string]struct{}, skip func(code string) bool) ([]string, error) {
+	seen := make(map[string]struct{}, n)
+	batch := make([]string, 0, n)
+	for len(batch) < n {
+		code, err := g.Next()
+		if err != nil {
+			return nil, err
+		}
+		if _, dup := seen[code]; dup {
+			continue
+		}
+		if _, dup := exclude[code]; dup {
+			continue
+		}
+		if skip != nil && skip(code) {
+			continue
+		}
+		seen[code] = struct{}{}
+		batch = append(batch, code)
+	}
+	return batch, nil
+}
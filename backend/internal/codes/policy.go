@@ -0,0 +1,35 @@
+package codes
+
+import "strings"
+
+// Voucher code case policies, selected with VOUCHER_CODE_CASE.
+const (
+	CaseUpper    = "upper"
+	CasePreserve = "preserve"
+)
+
+// Policy is the single place that decides how voucher codes are normalized
+// and compared. Codes are always unique case-insensitively; PreserveCase only
+// controls whether the code is stored as typed or uppercased.
+type Policy struct {
+	PreserveCase bool
+}
+
+func NewPolicy(caseMode string) Policy {
+	return Policy{PreserveCase: caseMode == CasePreserve}
+}
+
+// Normalize returns code in the form it is stored in.
+func (p Policy) Normalize(code string) string {
+	code = strings.TrimSpace(code)
+	if p.PreserveCase {
+		return code
+	}
+	return strings.ToUpper(code)
+}
+
+// Key returns the form codes are compared in; two codes with the same key are
+// the same voucher code. It matches the UPPER(voucher_code) unique index.
+func (p Policy) Key(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
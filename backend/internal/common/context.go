@@ -0,0 +1,39 @@
+package common
+
+import "context"
+
+type contextKey int
+
+const (
+	actorContextKey contextKey = iota
+	requestIDContextKey
+)
+
+// SystemActor is reported as the actor of changes made outside an
+// authenticated request, e.g. by background jobs.
+const SystemActor = "system"
+
+// WithActor returns a copy of ctx carrying the authenticated actor.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorContextKey, actor)
+}
+
+// ActorFromContext returns the actor stored by WithActor, or SystemActor.
+func ActorFromContext(ctx context.Context) string {
+	if actor, ok := ctx.Value(actorContextKey).(string); ok && actor != "" {
+		return actor
+	}
+	return SystemActor
+}
+
+// WithRequestID returns a copy of ctx carrying the request ID.
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDContextKey, requestID)
+}
+
+// RequestIDFromContext returns the request ID stored by WithRequestID, or ""
+// outside a request.
+func RequestIDFromContext(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDContextKey).(string)
+	return requestID
+}
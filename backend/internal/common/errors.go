@@ -42,3 +42,23 @@ func NewConflictError(message string, err error) *AppError {
 func NewUnauthorizedError(message string, err error) *AppError {
 	return NewAppError(http.StatusUnauthorized, message, err)
 }
+
+func NewForbiddenError(message string, err error) *AppError {
+	return NewAppError(http.StatusForbidden, message, err)
+}
+
+func NewUnprocessableError(message string, err error) *AppError {
+	return NewAppError(http.StatusUnprocessableEntity, message, err)
+}
+
+func NewPreconditionFailedError(message string, err error) *AppError {
+	return NewAppError(http.StatusPreconditionFailed, message, err)
+}
+
+func NewPreconditionRequiredError(message string, err error) *AppError {
+	return NewAppError(http.StatusPreconditionRequired, message, err)
+}
+
+func NewPayloadTooLargeError(message string, err error) *AppError {
+	return NewAppError(http.StatusRequestEntityTooLarge, message, err)
+}
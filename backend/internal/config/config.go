@@ -6,6 +6,9 @@ import (
 	"strconv"
 	"strings"
 	"time"
+	// Embedded so BUSINESS_TIMEZONE and voucher time zones resolve even on
+	// hosts without a system zoneinfo database.
+	_ "time/tzdata"
 
 	"github.com/joho/godotenv"
 )
@@ -13,24 +16,50 @@ import (
 const (
 	defaultEnv                 = "development"
 	defaultServerPort          = "8080"
-	defaultAuthToken           = "123456"
 	defaultCSVMaxSizeMB        = int64(5)
 	defaultDatabaseMaxConns    = int32(10)
 	defaultDatabaseMinConns    = int32(2)
 	defaultQueryTimeoutSeconds = 5
 	defaultCORSAllowedOrigins  = "*"
+	defaultCurrency            = "IDR"
+	defaultVoucherCodeCase     = "upper"
+	defaultReservationTTL      = 15 * 60
+	defaultReservationSweep    = 60
+	defaultIdempotencyTTLHours = 24
+	defaultIdempotencyLease    = 5 * 60
+	defaultBusinessTimezone    = "UTC"
+	defaultAccessTokenTTLMin   = 15
+	defaultRefreshTokenTTLHrs  = 7 * 24
+	defaultJWTIssuer           = "discount-voucher-management"
 )
 
+// multipartOverheadBytes is allowed on top of CSV_MAX_SIZE_MB for the
+// multipart framing and form fields around an uploaded file.
+const multipartOverheadBytes = 1024 * 1024
+
 type Config struct {
 	Env                string
 	ServerPort         string
 	DatabaseURL        string
 	DatabaseMaxConns   int32
 	DatabaseMinConns   int32
-	AuthToken          string
 	CSVMaxSizeBytes    int64
 	QueryTimeout       time.Duration
 	CORSAllowedOrigins []string
+	DefaultCurrency    string
+	VoucherCodeCase    string
+	ReservationTTL     time.Duration
+	ReservationSweep   time.Duration
+	IdempotencyTTL     time.Duration
+	IdempotencyLease   time.Duration
+	// IdempotencyMaxBody caps the request bodies the idempotency middleware
+	// buffers; it covers the largest CSV upload.
+	IdempotencyMaxBody int64
+	RequireIfMatch     bool
+	BusinessTimezone   string
+	AccessTokenTTL     time.Duration
+	RefreshTokenTTL    time.Duration
+	JWTIssuer          string
 }
 
 func Load() (Config, error) {
@@ -42,15 +71,39 @@ func Load() (Config, error) {
 		DatabaseURL:        os.Getenv("DATABASE_URL"),
 		DatabaseMaxConns:   getEnvAsInt32("DATABASE_MAX_CONNS", defaultDatabaseMaxConns),
 		DatabaseMinConns:   getEnvAsInt32("DATABASE_MIN_CONNS", defaultDatabaseMinConns),
-		AuthToken:          getEnv("AUTH_TOKEN", defaultAuthToken),
 		CSVMaxSizeBytes:    getEnvAsInt64("CSV_MAX_SIZE_MB", defaultCSVMaxSizeMB) * 1024 * 1024,
 		QueryTimeout:       time.Duration(getEnvAsInt("QUERY_TIMEOUT_SECONDS", defaultQueryTimeoutSeconds)) * time.Second,
 		CORSAllowedOrigins: getEnvAsSlice("CORS_ALLOWED_ORIGINS", defaultCORSAllowedOrigins),
+		DefaultCurrency:    strings.ToUpper(getEnv("DEFAULT_CURRENCY", defaultCurrency)),
+		VoucherCodeCase:    strings.ToLower(getEnv("VOUCHER_CODE_CASE", defaultVoucherCodeCase)),
+		ReservationTTL:     time.Duration(getEnvAsInt("RESERVATION_TTL_SECONDS", defaultReservationTTL)) * time.Second,
+		ReservationSweep:   time.Duration(getEnvAsInt("RESERVATION_SWEEP_INTERVAL_SECONDS", defaultReservationSweep)) * time.Second,
+		IdempotencyTTL:     time.Duration(getEnvAsInt("IDEMPOTENCY_KEY_TTL_HOURS", defaultIdempotencyTTLHours)) * time.Hour,
+		IdempotencyLease:   time.Duration(getEnvAsInt("IDEMPOTENCY_LEASE_SECONDS", defaultIdempotencyLease)) * time.Second,
+		RequireIfMatch:     getEnvAsBool("REQUIRE_IF_MATCH", false),
+		BusinessTimezone:   getEnv("BUSINESS_TIMEZONE", defaultBusinessTimezone),
+		AccessTokenTTL:     time.Duration(getEnvAsInt("ACCESS_TOKEN_TTL_MINUTES", defaultAccessTokenTTLMin)) * time.Minute,
+		RefreshTokenTTL:    time.Duration(getEnvAsInt("REFRESH_TOKEN_TTL_HOURS", defaultRefreshTokenTTLHrs)) * time.Hour,
+		JWTIssuer:          getEnv("JWT_ISSUER", defaultJWTIssuer),
 	}
 
+	cfg.IdempotencyMaxBody = cfg.CSVMaxSizeBytes + multipartOverheadBytes
+
 	if cfg.DatabaseURL == "" {
 		return Config{}, errors.New("DATABASE_URL is required")
 	}
+	if cfg.VoucherCodeCase != "upper" && cfg.VoucherCodeCase != "preserve" {
+		return Config{}, errors.New("VOUCHER_CODE_CASE must be upper or preserve")
+	}
+	if cfg.ReservationTTL <= 0 || cfg.ReservationSweep <= 0 {
+		return Config{}, errors.New("RESERVATION_TTL_SECONDS and RESERVATION_SWEEP_INTERVAL_SECONDS must be positive")
+	}
+	if _, err := time.LoadLocation(cfg.BusinessTimezone); err != nil || cfg.BusinessTimezone == "Local" {
+		return Config{}, errors.New("BUSINESS_TIMEZONE must be an IANA time zone name such as Asia/Jakarta")
+	}
+	if cfg.AccessTokenTTL <= 0 || cfg.RefreshTokenTTL <= 0 {
+		return Config{}, errors.New("ACCESS_TOKEN_TTL_MINUTES and REFRESH_TOKEN_TTL_HOURS must be positive")
+	}
 
 	return cfg, nil
 }
@@ -89,6 +142,15 @@ func getEnvAsInt32(key string, fallback int32) int32 {
 	return fallback
 }
 
+func getEnvAsBool(key string, fallback bool) bool {
+	if valueStr, ok := os.LookupEnv(key); ok && valueStr != "" {
+		if value, err := strconv.ParseBool(valueStr); err == nil {
+			return value
+		}
+	}
+	return fallback
+}
+
 func getEnvAsSlice(key, fallback string) []string {
 	value := getEnv(key, fallback)
 	parts := strings.Split(value, ",")
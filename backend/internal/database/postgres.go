@@ -5,10 +5,20 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/mhakimsaputra17/discount-voucher-management/backend/internal/config"
 )
 
+// Querier is implemented by both *pgxpool.Pool and pgx.Tx so repositories can
+// run the same queries inside or outside a transaction.
+type Querier interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
 func Connect(ctx context.Context, cfg config.Config) (*pgxpool.Pool, error) {
 	poolConfig, err := pgxpool.ParseConfig(cfg.DatabaseURL)
 	if err != nil {
@@ -20,6 +30,9 @@ func Connect(ctx context.Context, cfg config.Config) (*pgxpool.Pool, error) {
 	poolConfig.MaxConnIdleTime = 5 * time.Minute
 	poolConfig.MaxConnLifetime = 2 * time.Hour
 	poolConfig.HealthCheckPeriod = time.Minute
+	// CURRENT_DATE and the voucher validity window follow the business time
+	// zone rather than whatever the database server is configured with.
+	poolConfig.ConnConfig.RuntimeParams["timezone"] = cfg.BusinessTimezone
 
 	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
 	if err != nil {
@@ -1,19 +1,25 @@
 package middleware
 
 import (
-	"strings"
-
 	"github.com/gin-gonic/gin"
+	"github.com/mhakimsaputra17/discount-voucher-management/backend/internal/auth"
 	"github.com/mhakimsaputra17/discount-voucher-management/backend/internal/common"
 	"github.com/mhakimsaputra17/discount-voucher-management/backend/internal/http/response"
 )
 
+const (
+	RoleStaff = auth.RoleStaff
+	RoleAdmin = auth.RoleAdmin
+)
+
 type AuthMiddleware struct {
-	token string
+	service *auth.Service
 }
 
-func NewAuthMiddleware(token string) *AuthMiddleware {
-	return &AuthMiddleware{token: token}
+// NewAuthMiddleware accepts the access tokens issued by POST /login and
+// POST /token/refresh.
+func NewAuthMiddleware(service *auth.Service) *AuthMiddleware {
+	return &AuthMiddleware{service: service}
 }
 
 func (m *AuthMiddleware) Handle() gin.HandlerFunc {
@@ -25,13 +31,36 @@ func (m *AuthMiddleware) Handle() gin.HandlerFunc {
 			return
 		}
 
-		parts := strings.SplitN(authHeader, " ", 2)
-		if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") || parts[1] != m.token {
+		token, ok := auth.BearerToken(authHeader)
+		if !ok {
 			response.Error(c, common.NewUnauthorizedError("invalid token", nil))
 			c.Abort()
 			return
 		}
 
+		claims, appErr := m.service.Authenticate(c.Request.Context(), token)
+		if appErr != nil {
+			response.Error(c, appErr)
+			c.Abort()
+			return
+		}
+
+		ctx := auth.WithClaims(c.Request.Context(), claims)
+		c.Request = c.Request.WithContext(common.WithActor(ctx, claims.Email))
+		c.Next()
+	}
+}
+
+// RequireRole rejects requests whose access token does not grant role. It
+// must run after Handle.
+func (m *AuthMiddleware) RequireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if claims, ok := auth.ClaimsFromContext(c.Request.Context()); !ok || !claims.HasRole(role) {
+			response.Error(c, common.NewForbiddenError("insufficient permissions", nil))
+			c.Abort()
+			return
+		}
+
 		c.Next()
 	}
 }
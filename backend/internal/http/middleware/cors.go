@@ -9,9 +9,9 @@ import (
 
 func NewCORSMiddleware(allowedOrigins []string) gin.HandlerFunc {
 	cfg := cors.Config{
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization"},
-		ExposeHeaders:    []string{"Content-Disposition"},
+		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "If-Match", IdempotencyKeyHeader, RequestIDHeader},
+		ExposeHeaders:    []string{"Content-Disposition", "ETag", IdempotentReplayedHeader, RequestIDHeader},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}
@@ -0,0 +1,193 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mhakimsaputra17/discount-voucher-management/backend/internal/common"
+	"github.com/mhakimsaputra17/discount-voucher-management/backend/internal/http/response"
+	"github.com/mhakimsaputra17/discount-voucher-management/backend/internal/idempotency"
+)
+
+const (
+	IdempotencyKeyHeader     = "Idempotency-Key"
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+	maxIdempotencyKeyLength  = 255
+)
+
+type IdempotencyMiddleware struct {
+	store   *idempotency.Store
+	timeout time.Duration
+	maxBody int64
+}
+
+// NewIdempotencyMiddleware returns the middleware. Request bodies sent with
+// an Idempotency-Key are buffered so they can be fingerprinted; bodies
+// larger than maxBody are rejected with 413.
+func NewIdempotencyMiddleware(store *idempotency.Store, timeout time.Duration, maxBody int64) *IdempotencyMiddleware {
+	return &IdempotencyMiddleware{store: store, timeout: timeout, maxBody: maxBody}
+}
+
+// Handle makes the route honour the Idempotency-Key header. The first request
+// with a key runs normally and its response is stored; a retry with the same
+// key and the same request gets the stored response back, and a retry with a
+// different request is rejected with 422. Requests without the header are
+// not affected. Keys are scoped to the authenticated user, so it must run
+// after the auth middleware. Server errors and panics release the key, so
+// the request can be retried.
+func (m *IdempotencyMiddleware) Handle() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := strings.TrimSpace(c.GetHeader(IdempotencyKeyHeader))
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			response.Error(c, common.NewValidationError("Idempotency-Key must be at most 255 characters", nil))
+			c.Abort()
+			return
+		}
+
+		// The body is hashed while it is read, and the one buffered copy is
+		// handed on to the handler.
+		var body bytes.Buffer
+		if n := c.Request.ContentLength; n > 0 && n <= m.maxBody {
+			body.Grow(int(n))
+		}
+		bodyHash := sha256.New()
+		limited := http.MaxBytesReader(c.Writer, c.Request.Body, m.maxBody)
+		if _, err := io.Copy(&body, io.TeeReader(limited, bodyHash)); err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				response.Error(c, common.NewPayloadTooLargeError("request body is too large", err))
+			} else {
+				response.Error(c, common.NewValidationError("failed to read request body", err))
+			}
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body.Bytes()))
+
+		fingerprint, err := requestFingerprint(c.Request.Header.Get("Content-Type"), body.Bytes(), hex.EncodeToString(bodyHash.Sum(nil)))
+		if err != nil {
+			response.Error(c, common.NewValidationError("invalid request body", err))
+			c.Abort()
+			return
+		}
+		scope := common.ActorFromContext(c.Request.Context()) + " " + c.Request.Method + " " + c.Request.URL.Path
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), m.timeout)
+		rec, claimed, err := m.store.Begin(ctx, scope, key, fingerprint)
+		cancel()
+		if err != nil {
+			response.Error(c, common.NewInternalError("failed to check Idempotency-Key", err))
+			c.Abort()
+			return
+		}
+
+		if !claimed {
+			switch {
+			case rec.Fingerprint != fingerprint:
+				response.Error(c, common.NewUnprocessableError("Idempotency-Key has already been used with a different request", nil))
+			case !rec.Completed:
+				response.Error(c, common.NewConflictError("a request with this Idempotency-Key is still being processed", nil))
+			default:
+				c.Header(IdempotentReplayedHeader, "true")
+				c.Data(rec.StatusCode, rec.ContentType, rec.Body)
+			}
+			c.Abort()
+			return
+		}
+
+		// The client may have given up already, which is exactly when it will
+		// retry, so the outcome is saved even if the request was cancelled.
+		outcomeCtx := func() (context.Context, context.CancelFunc) {
+			return context.WithTimeout(context.WithoutCancel(c.Request.Context()), m.timeout)
+		}
+
+		// Unless the response is stored below, the claim is released on the
+		// way out, including when a handler panics.
+		completed := false
+		defer func() {
+			if completed {
+				return
+			}
+			ctx, cancel := outcomeCtx()
+			defer cancel()
+			if err := m.store.Release(ctx, scope, key, rec.Token); err != nil {
+				_ = c.Error(err)
+			}
+		}()
+
+		writer := &capturingWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		c.Next()
+
+		status := writer.Status()
+		if status >= http.StatusInternalServerError {
+			return
+		}
+		ctx, cancel = outcomeCtx()
+		defer cancel()
+		err = m.store.Complete(ctx, scope, key, rec.Token, status, writer.Header().Get("Content-Type"), writer.body.Bytes())
+		if err != nil {
+			_ = c.Error(err)
+		}
+		// A lost claim belongs to another request now; Release leaves it alone.
+		completed = err == nil || errors.Is(err, idempotency.ErrClaimLost)
+	}
+}
+
+// requestFingerprint returns bodyHash, the hex SHA-256 of the raw body,
+// except for multipart bodies, which are hashed part by part so a retry with
+// a freshly generated boundary still matches.
+func requestFingerprint(contentType string, body []byte, bodyHash string) (string, error) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || !strings.HasPrefix(mediaType, "multipart/") || params["boundary"] == "" {
+		return bodyHash, nil
+	}
+
+	hash := sha256.New()
+	reader := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		hash.Write([]byte(part.FormName() + "\x00" + part.FileName() + "\x00"))
+		if _, err := io.Copy(hash, part); err != nil {
+			return "", err
+		}
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// capturingWriter keeps a copy of the response body so it can be stored.
+type capturingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *capturingWriter) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *capturingWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
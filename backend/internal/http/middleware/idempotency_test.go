@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestIdempotencyRejectsOversizedBody(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// The store is never reached: the body is rejected while it is read.
+	m := NewIdempotencyMiddleware(nil, time.Second, 16)
+	handlerRan := false
+	r := gin.New()
+	r.POST("/vouchers/upload-csv", m.Handle(), func(c *gin.Context) {
+		handlerRan = true
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/vouchers/upload-csv", strings.NewReader(strings.Repeat("x", 17)))
+	req.Header.Set(IdempotencyKeyHeader, "key-1")
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusRequestEntityTooLarge)
+	}
+	if handlerRan {
+		t.Fatal("handler ran for an oversized body")
+	}
+}
+
+func multipartBody(t *testing.T, boundary, content string) ([]byte, string) {
+	t.Helper()
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	if err := w.SetBoundary(boundary); err != nil {
+		t.Fatal(err)
+	}
+	part, err := w.CreateFormFile("file", "vouchers.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write([]byte(content))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes(), w.FormDataContentType()
+}
+
+func TestRequestFingerprint(t *testing.T) {
+	rawHash := func(body []byte) string {
+		sum := sha256.Sum256(body)
+		return hex.EncodeToString(sum[:])
+	}
+	fingerprint := func(contentType string, body []byte) string {
+		t.Helper()
+		got, err := requestFingerprint(contentType, body, rawHash(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+
+	json := []byte(`{"voucher_code":"A"}`)
+	if got := fingerprint("application/json", json); got != rawHash(json) {
+		t.Fatalf("JSON fingerprint = %s, want the body hash %s", got, rawHash(json))
+	}
+
+	first, firstType := multipartBody(t, "boundary-one", "voucher_code\nA\n")
+	second, secondType := multipartBody(t, "boundary-two", "voucher_code\nA\n")
+	other, otherType := multipartBody(t, "boundary-one", "voucher_code\nB\n")
+	if fingerprint(firstType, first) != fingerprint(secondType, second) {
+		t.Fatal("multipart fingerprint depends on the boundary")
+	}
+	if fingerprint(firstType, first) == fingerprint(otherType, other) {
+		t.Fatal("multipart fingerprint ignores the file content")
+	}
+}
@@ -2,23 +2,92 @@ package router
 
 import (
 	"github.com/gin-gonic/gin"
+	"github.com/mhakimsaputra17/discount-voucher-management/backend/internal/audit"
 	"github.com/mhakimsaputra17/discount-voucher-management/backend/internal/auth"
+	"github.com/mhakimsaputra17/discount-voucher-management/backend/internal/campaign"
 	"github.com/mhakimsaputra17/discount-voucher-management/backend/internal/http/middleware"
 	"github.com/mhakimsaputra17/discount-voucher-management/backend/internal/voucher"
 )
 
-func RegisterRoutes(r *gin.Engine, authHandler *auth.Handler, authMiddleware *middleware.AuthMiddleware, voucherHandler *voucher.Handler) {
+func RegisterRoutes(r *gin.Engine, authHandler *auth.Handler, authMiddleware *middleware.AuthMiddleware, idempotencyMiddleware *middleware.IdempotencyMiddleware, voucherHandler *voucher.Handler, campaignHandler *campaign.Handler, auditHandler *audit.Handler) {
 	r.POST("/login", authHandler.Login)
+	r.POST("/token/refresh", authHandler.Refresh)
+	r.POST("/logout", authHandler.Logout)
+	r.GET("/.well-known/jwks.json", authHandler.JWKS)
+	r.GET("/me", authMiddleware.Handle(), authHandler.Me)
+
+	// Non-idempotent POSTs honour the Idempotency-Key header.
+	idempotent := idempotencyMiddleware.Handle()
 
 	api := r.Group("/vouchers")
 	api.Use(authMiddleware.Handle())
 	{
 		api.GET("", voucherHandler.List)
-		api.POST("", voucherHandler.Create)
+		api.POST("", idempotent, voucherHandler.Create)
 		api.GET("/export", voucherHandler.Export)
-		api.POST("/upload-csv", voucherHandler.UploadCSV)
+		api.GET("/trash", voucherHandler.Trash)
+		api.GET("/lookup", voucherHandler.Lookup)
+		api.POST("/upload-csv", idempotent, voucherHandler.UploadCSV)
+		api.POST("/generate", idempotent, voucherHandler.Generate)
+		api.POST("/redeem", idempotent, voucherHandler.Redeem)
+		api.POST("/evaluate", voucherHandler.Evaluate)
+		api.POST("/calculate", voucherHandler.Calculate)
 		api.GET("/:id", voucherHandler.Get)
 		api.PUT("/:id", voucherHandler.Update)
+		api.PATCH("/:id", voucherHandler.Patch)
 		api.DELETE("/:id", voucherHandler.Delete)
+		api.POST("/:id/transition", voucherHandler.Transition)
+		api.POST("/:id/restore", voucherHandler.Restore)
+		api.GET("/:id/history", auditHandler.History)
+		api.GET("/:id/versions", voucherHandler.Versions)
+		api.POST("/:id/revert", voucherHandler.Revert)
+		api.POST("/:id/clone", idempotent, voucherHandler.Clone)
+		api.POST("/:id/reservations", idempotent, voucherHandler.Reserve)
+		api.DELETE("/:id/purge", authMiddleware.RequireRole(middleware.RoleAdmin), voucherHandler.Purge)
+	}
+
+	reservations := r.Group("/reservations")
+	reservations.Use(authMiddleware.Handle())
+	{
+		reservations.GET("/:id", voucherHandler.GetReservation)
+		reservations.POST("/:id/confirm", idempotent, voucherHandler.ConfirmReservation)
+		reservations.POST("/:id/release", voucherHandler.ReleaseReservation)
+	}
+
+	tags := r.Group("/tags")
+	tags.Use(authMiddleware.Handle())
+	{
+		tags.GET("", voucherHandler.ListTags)
+	}
+
+	campaigns := r.Group("/campaigns")
+	campaigns.Use(authMiddleware.Handle())
+	{
+		campaigns.GET("", campaignHandler.List)
+		campaigns.POST("", campaignHandler.Create)
+		campaigns.GET("/:id", campaignHandler.Get)
+		campaigns.PUT("/:id", campaignHandler.Update)
+		campaigns.DELETE("/:id", campaignHandler.Delete)
+	}
+
+	users := r.Group("/users")
+	users.Use(authMiddleware.Handle(), authMiddleware.RequireRole(middleware.RoleAdmin))
+	{
+		users.GET("", authHandler.ListUsers)
+		users.POST("", authHandler.CreateUser)
+		users.POST("/:id/deactivate", authHandler.Deactivate)
+		users.POST("/:id/activate", authHandler.Activate)
+	}
+
+	signingKeys := r.Group("/auth/signing-keys")
+	signingKeys.Use(authMiddleware.Handle(), authMiddleware.RequireRole(middleware.RoleAdmin))
+	{
+		signingKeys.POST("/rotate", authHandler.RotateSigningKey)
+	}
+
+	auditLog := r.Group("/audit")
+	auditLog.Use(authMiddleware.Handle())
+	{
+		auditLog.GET("", auditHandler.List)
 	}
 }
@@ -0,0 +1,182 @@
+// Package idempotency stores the outcome of requests sent with an
+// Idempotency-Key header so retries can be answered with the original
+// response instead of being executed again.
+package idempotency
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/mhakimsaputra17/discount-voucher-management/backend/internal/logger"
+)
+
+// ErrClaimLost is returned by Complete when the claim's lease ran out and
+// another request took the key over.
+var ErrClaimLost = errors.New("idempotency key claim was taken over")
+
+// Record is what is stored for a key. Completed is false while the original
+// request is still being processed. Token identifies the claim and is only
+// set on a record returned with claimed true.
+type Record struct {
+	Fingerprint string
+	Completed   bool
+	StatusCode  int
+	ContentType string
+	Body        []byte
+	Token       string
+}
+
+// Store keeps idempotency records for ttl, after which a key can be reused.
+// A claimed key is leased to its request for lease; a retry of the same
+// request may take over a claim whose lease has run out.
+type Store struct {
+	db    *pgxpool.Pool
+	ttl   time.Duration
+	lease time.Duration
+}
+
+func NewStore(db *pgxpool.Pool, ttl, lease time.Duration) *Store {
+	return &Store{db: db, ttl: ttl, lease: lease}
+}
+
+// Begin claims key within scope for a request with the given fingerprint.
+// When the key is unused (or its previous record has expired), or it is held
+// for the same request by a claim whose lease has run out, it is recorded as
+// in progress and claimed is true. Otherwise the existing record is returned
+// and the caller must not execute the request.
+func (s *Store) Begin(ctx context.Context, scope, key, fingerprint string) (rec Record, claimed bool, err error) {
+	if _, err := s.db.Exec(ctx, `
+		DELETE FROM idempotency_keys
+		WHERE scope = $1 AND key = $2 AND created_at < NOW() - $3::BIGINT * INTERVAL '1 second'
+	`, scope, key, int64(s.ttl/time.Second)); err != nil {
+		return Record{}, false, err
+	}
+
+	token, err := newClaimToken()
+	if err != nil {
+		return Record{}, false, err
+	}
+	cmdTag, err := s.db.Exec(ctx, `
+		INSERT INTO idempotency_keys (scope, key, fingerprint, locked_until, claim_token)
+		VALUES ($1, $2, $3, NOW() + $4::BIGINT * INTERVAL '1 second', $5)
+		ON CONFLICT (scope, key) DO UPDATE
+		SET locked_until = EXCLUDED.locked_until,
+			claim_token = EXCLUDED.claim_token
+		WHERE idempotency_keys.status_code IS NULL
+			AND idempotency_keys.fingerprint = EXCLUDED.fingerprint
+			AND idempotency_keys.locked_until <= NOW()
+	`, scope, key, fingerprint, int64(s.lease/time.Second), token)
+	if err != nil {
+		return Record{}, false, err
+	}
+	if cmdTag.RowsAffected() == 1 {
+		return Record{Fingerprint: fingerprint, Token: token}, true, nil
+	}
+
+	var (
+		statusCode  *int
+		contentType *string
+	)
+	err = s.db.QueryRow(ctx, `
+		SELECT fingerprint, status_code, content_type, response_body
+		FROM idempotency_keys
+		WHERE scope = $1 AND key = $2
+	`, scope, key).Scan(&rec.Fingerprint, &statusCode, &contentType, &rec.Body)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// The record was released between the insert and the select; let
+		// the caller retry the claim.
+		return s.Begin(ctx, scope, key, fingerprint)
+	}
+	if err != nil {
+		return Record{}, false, err
+	}
+	if statusCode != nil {
+		rec.Completed = true
+		rec.StatusCode = *statusCode
+	}
+	if contentType != nil {
+		rec.ContentType = *contentType
+	}
+	return rec, false, nil
+}
+
+// Complete stores the response of the key claimed with token. It returns
+// ErrClaimLost when the claim has been taken over in the meantime.
+func (s *Store) Complete(ctx context.Context, scope, key, token string, statusCode int, contentType string, body []byte) error {
+	cmdTag, err := s.db.Exec(ctx, `
+		UPDATE idempotency_keys
+		SET status_code = $4,
+			content_type = $5,
+			response_body = $6,
+			completed_at = NOW(),
+			locked_until = NULL
+		WHERE scope = $1 AND key = $2 AND claim_token = $3 AND status_code IS NULL
+	`, scope, key, token, statusCode, contentType, body)
+	if err != nil {
+		return err
+	}
+	if cmdTag.RowsAffected() == 0 {
+		return ErrClaimLost
+	}
+	return nil
+}
+
+// Release forgets the key claimed with token so the request can be retried,
+// e.g. after a server error that should not be replayed. A claim that has
+// been taken over is left alone.
+func (s *Store) Release(ctx context.Context, scope, key, token string) error {
+	_, err := s.db.Exec(ctx, `
+		DELETE FROM idempotency_keys
+		WHERE scope = $1 AND key = $2 AND claim_token = $3 AND status_code IS NULL
+	`, scope, key, token)
+	return err
+}
+
+func newClaimToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// DeleteExpired removes records older than the TTL.
+func (s *Store) DeleteExpired(ctx context.Context) (int64, error) {
+	cmdTag, err := s.db.Exec(ctx, `
+		DELETE FROM idempotency_keys
+		WHERE created_at < NOW() - $1::BIGINT * INTERVAL '1 second'
+	`, int64(s.ttl/time.Second))
+	if err != nil {
+		return 0, err
+	}
+	return cmdTag.RowsAffected(), nil
+}
+
+// RunCleanup deletes expired records every interval until ctx is cancelled.
+func (s *Store) RunCleanup(ctx context.Context, interval, timeout time.Duration, log *logger.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			cleanupCtx, cancel := context.WithTimeout(ctx, timeout)
+			deleted, err := s.DeleteExpired(cleanupCtx)
+			cancel()
+			if err != nil {
+				log.Errorf("failed to delete expired idempotency keys: %v", err)
+				continue
+			}
+			if deleted > 0 {
+				log.Infof("deleted %d expired idempotency keys", deleted)
+			}
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package voucher
+
+import (
+	"context"
+
+	"github.com/mhakimsaputra17/discount-voucher-management/backend/internal/audit"
+)
+
+// recordAudit logs an action on a voucher within tx. before or after is nil
+// on the side of the action where the voucher did not exist.
+func recordAudit(ctx context.Context, tx *Repository, action string, before, after *Voucher) error {
+	entry, err := newAuditEntry(ctx, action, before, after)
+	if err != nil {
+		return err
+	}
+	return tx.RecordAudit(ctx, entry)
+}
+
+func newAuditEntry(ctx context.Context, action string, before, after *Voucher) (audit.Entry, error) {
+	var (
+		voucherID               int64
+		beforeValue, afterValue any
+	)
+	if before != nil {
+		voucherID, beforeValue = before.ID, before
+	}
+	if after != nil {
+		voucherID, afterValue = after.ID, after
+	}
+	return audit.NewEntry(ctx, voucherID, action, beforeValue, afterValue)
+}
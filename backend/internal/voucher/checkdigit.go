@@ -0,0 +1,67 @@
+package voucher
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/mhakimsaputra17/discount-voucher-management/backend/internal/codes"
+	"github.com/mhakimsaputra17/discount-voucher-management/backend/internal/common"
+)
+
+// checkDigitFormatsTTL bounds how long a prefix registered by another
+// instance can go unnoticed.
+const checkDigitFormatsTTL = time.Minute
+
+const invalidCheckDigitMessage = "voucher_code has an invalid check character, it was probably mistyped"
+
+// checkDigitFormats caches the registered check-digit formats so mistyped
+// codes can be rejected without looking the voucher up.
+type checkDigitFormats struct {
+	mu       sync.RWMutex
+	formats  []codes.Format
+	loadedAt time.Time
+}
+
+func (c *checkDigitFormats) get(ctx context.Context, repo *Repository) ([]codes.Format, error) {
+	c.mu.RLock()
+	formats, fresh := c.formats, time.Since(c.loadedAt) < checkDigitFormatsTTL
+	c.mu.RUnlock()
+	if fresh {
+		return formats, nil
+	}
+
+	formats, err := repo.ListCheckDigitFormats(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.formats, c.loadedAt = formats, time.Now()
+	c.mu.Unlock()
+	return formats, nil
+}
+
+func (c *checkDigitFormats) invalidate() {
+	c.mu.Lock()
+	c.loadedAt = time.Time{}
+	c.mu.Unlock()
+}
+
+// verifyCheckDigit rejects a code that falls under a registered check-digit
+// prefix but does not carry a valid check character. If the formats cannot
+// be loaded the code is let through; the voucher lookup that follows is the
+// real source of truth.
+func (s *Service) verifyCheckDigit(ctx context.Context, code string) *common.AppError {
+	formats, err := s.checkDigits.get(ctx, s.repo)
+	if err != nil {
+		s.logger.Errorf("failed to load check-digit formats: %v", err)
+		return nil
+	}
+
+	code = s.codePolicy.Key(code)
+	if f, ok := codes.Match(formats, code); ok && f.Verify(code) != nil {
+		return common.NewUnprocessableError(invalidCheckDigitMessage, codes.ErrInvalidCheckDigit)
+	}
+	return nil
+}
@@ -0,0 +1,213 @@
+package voucher
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// csvColumns is the column order written by Export. UploadCSV accepts any
+// subset that includes voucher_code and expiry_date, in any order, so files
+// using the original voucher_code,discount_percent,expiry_date layout still
+// import.
+var csvColumns = []string{
+	"voucher_code",
+	"discount_type",
+	"discount_percent",
+	"discount_amount",
+	"currency",
+	"min_order_amount",
+	"max_discount_amount",
+	"valid_from",
+	"expiry_date",
+	"timezone",
+	"campaign_id",
+	"tags",
+	"stackable",
+	"exclusivity_group",
+	"include_skus",
+	"exclude_skus",
+	"include_categories",
+	"exclude_categories",
+	"personal_customer_id",
+	"allowed_customer_ids",
+	"allowed_email_hashes",
+}
+
+// csvListSeparator separates the values inside list columns such as tags,
+// e.g. "black-friday|email".
+const csvListSeparator = "|"
+
+// expiry_date may be omitted when every row belongs to a campaign that
+// provides one; rows without it are rejected individually.
+var requiredCSVColumns = []string{"voucher_code"}
+
+// csvHeader maps a column name to its index in each record.
+type csvHeader map[string]int
+
+func parseCSVHeader(record []string) (csvHeader, error) {
+	known := make(map[string]struct{}, len(csvColumns))
+	for _, col := range csvColumns {
+		known[col] = struct{}{}
+	}
+
+	header := make(csvHeader, len(record))
+	for i, raw := range record {
+		col := strings.ToLower(strings.TrimSpace(strings.TrimPrefix(raw, "\ufeff")))
+		if _, ok := known[col]; !ok {
+			return nil, fmt.Errorf("unknown column %q", col)
+		}
+		if _, dup := header[col]; dup {
+			return nil, fmt.Errorf("duplicate column %q", col)
+		}
+		header[col] = i
+	}
+
+	for _, col := range requiredCSVColumns {
+		if _, ok := header[col]; !ok {
+			return nil, fmt.Errorf("missing column %q", col)
+		}
+	}
+
+	return header, nil
+}
+
+func (h csvHeader) value(record []string, column string) string {
+	idx, ok := h[column]
+	if !ok || idx >= len(record) {
+		return ""
+	}
+	return strings.TrimSpace(record[idx])
+}
+
+// voucher converts a CSV record into a Voucher. A non-empty reason is returned
+// when a value cannot be parsed; semantic validation is left to the service.
+func (h csvHeader) voucher(record []string) (Voucher, string) {
+	v := Voucher{
+		VoucherCode:  h.value(record, "voucher_code"),
+		DiscountType: h.value(record, "discount_type"),
+		Currency:     h.value(record, "currency"),
+		ValidFrom:    h.value(record, "valid_from"),
+		ExpiryDate:   h.value(record, "expiry_date"),
+	}
+
+	if raw := h.value(record, "discount_percent"); raw != "" {
+		percent, err := strconv.Atoi(raw)
+		if err != nil {
+			return Voucher{}, "discount_percent must be integer between 1 and 100"
+		}
+		v.DiscountPercent = percent
+	}
+
+	if raw := h.value(record, "discount_amount"); raw != "" {
+		amount, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return Voucher{}, "discount_amount must be an integer amount in minor units"
+		}
+		v.DiscountAmount = amount
+	}
+
+	var reason string
+	if v.MinOrderAmount, reason = h.optionalAmount(record, "min_order_amount"); reason != "" {
+		return Voucher{}, reason
+	}
+	if v.MaxDiscountAmount, reason = h.optionalAmount(record, "max_discount_amount"); reason != "" {
+		return Voucher{}, reason
+	}
+	if v.CampaignID, reason = h.optionalAmount(record, "campaign_id"); reason != "" {
+		return Voucher{}, "campaign_id must be an integer"
+	}
+	if raw := h.value(record, "tags"); raw != "" {
+		v.Tags = strings.Split(raw, csvListSeparator)
+	}
+	if raw := h.value(record, "stackable"); raw != "" {
+		stackable, err := strconv.ParseBool(raw)
+		if err != nil {
+			return Voucher{}, "stackable must be true or false"
+		}
+		v.Stackable = stackable
+	}
+	if raw := h.value(record, "exclusivity_group"); raw != "" {
+		v.ExclusivityGroup = &raw
+	}
+	for _, list := range scopeLists {
+		if raw := h.value(record, list.field); raw != "" {
+			*list.values(&v) = strings.Split(raw, csvListSeparator)
+		}
+	}
+	if raw := h.value(record, "timezone"); raw != "" {
+		v.Timezone = &raw
+	}
+	if raw := h.value(record, "personal_customer_id"); raw != "" {
+		v.PersonalCustomerID = &raw
+	}
+	for _, list := range allowlists {
+		if raw := h.value(record, list.field); raw != "" {
+			*list.values(&v) = strings.Split(raw, csvListSeparator)
+		}
+	}
+
+	return v, ""
+}
+
+// optionalAmount parses a column that maps to a nullable integer; an empty
+// cell means "not set".
+func (h csvHeader) optionalAmount(record []string, column string) (*int64, string) {
+	raw := h.value(record, column)
+	if raw == "" {
+		return nil, ""
+	}
+	amount, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		return nil, column + " must be an integer amount in minor units"
+	}
+	return &amount, ""
+}
+
+// voucherCSVRecord formats v in csvColumns order.
+func voucherCSVRecord(v Voucher) []string {
+	return []string{
+		v.VoucherCode,
+		v.DiscountType,
+		formatOptionalInt(int64(v.DiscountPercent)),
+		formatOptionalInt(v.DiscountAmount),
+		v.Currency,
+		formatNullableInt(v.MinOrderAmount),
+		formatNullableInt(v.MaxDiscountAmount),
+		v.ValidFrom,
+		v.ExpiryDate,
+		formatNullableString(v.Timezone),
+		formatNullableInt(v.CampaignID),
+		strings.Join(v.Tags, csvListSeparator),
+		strconv.FormatBool(v.Stackable),
+		formatNullableString(v.ExclusivityGroup),
+		strings.Join(v.IncludeSKUs, csvListSeparator),
+		strings.Join(v.ExcludeSKUs, csvListSeparator),
+		strings.Join(v.IncludeCategories, csvListSeparator),
+		strings.Join(v.ExcludeCategories, csvListSeparator),
+		formatNullableString(v.PersonalCustomerID),
+		strings.Join(v.AllowedCustomerIDs, csvListSeparator),
+		strings.Join(v.AllowedEmailHashes, csvListSeparator),
+	}
+}
+
+func formatOptionalInt(value int64) string {
+	if value == 0 {
+		return ""
+	}
+	return strconv.FormatInt(value, 10)
+}
+
+func formatNullableString(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return *value
+}
+
+func formatNullableInt(value *int64) string {
+	if value == nil {
+		return ""
+	}
+	return strconv.FormatInt(*value, 10)
+}
@@ -0,0 +1,184 @@
+package voucher
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/mhakimsaputra17/discount-voucher-management/backend/internal/common"
+)
+
+// allowlist is one of the lists restricting a voucher to some customers, and
+// where it is stored.
+type allowlist struct {
+	field  string
+	table  string
+	column string
+	values func(v *Voucher) *[]string
+}
+
+var allowlists = []allowlist{
+	{"allowed_customer_ids", "voucher_customers", "customer_id", func(v *Voucher) *[]string { return &v.AllowedCustomerIDs }},
+	{"allowed_email_hashes", "voucher_customer_emails", "email_hash", func(v *Voucher) *[]string { return &v.AllowedEmailHashes }},
+}
+
+// orderCustomer identifies who an order is for. emailHash is empty when no
+// email was given, see hashEmail.
+type orderCustomer struct {
+	id        string
+	emailHash string
+}
+
+func newCustomer(id, email string) orderCustomer {
+	c := orderCustomer{id: strings.TrimSpace(id)}
+	if email = strings.TrimSpace(email); email != "" {
+		c.emailHash = hashEmail(email)
+	}
+	return c
+}
+
+// hashEmail returns the hex SHA-256 of the trimmed, lowercased email, the
+// form stored in allowed_email_hashes.
+func hashEmail(email string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(email))))
+	return hex.EncodeToString(sum[:])
+}
+
+// targeted reports whether v is restricted to some customers.
+func (v Voucher) targeted() bool {
+	return v.PersonalCustomerID != nil || len(v.AllowedCustomerIDs) > 0 || len(v.AllowedEmailHashes) > 0
+}
+
+// checkCustomer rejects c when v is personal to someone else or c is not on
+// its allowlists.
+func checkCustomer(v Voucher, c orderCustomer) *common.AppError {
+	if !v.targeted() {
+		return nil
+	}
+	if v.PersonalCustomerID != nil {
+		if c.id == "" {
+			return common.NewValidationError("customer_id is required for this voucher", nil)
+		}
+		if c.id != *v.PersonalCustomerID {
+			return common.NewUnprocessableError("voucher is assigned to another customer", nil)
+		}
+		return nil
+	}
+
+	if c.id == "" && c.emailHash == "" {
+		return common.NewValidationError("customer_id or customer_email is required for this voucher", nil)
+	}
+	if (c.id != "" && contains(v.AllowedCustomerIDs, c.id)) || (c.emailHash != "" && contains(v.AllowedEmailHashes, c.emailHash)) {
+		return nil
+	}
+	return common.NewUnprocessableError("voucher is not available to this customer", nil)
+}
+
+// copyAllowlists sets the allowlists of v that are set in from.
+func (v *Voucher) copyAllowlists(from Voucher) {
+	for _, list := range allowlists {
+		if values := *list.values(&from); values != nil {
+			*list.values(v) = values
+		}
+	}
+}
+
+// normalizeCustomers validates the customer targeting of v. A personal
+// voucher is single-use, so max_redemptions defaults to 1 and may not be
+// anything else, and it cannot have allowlists as well.
+func normalizeCustomers(v *Voucher) *common.AppError {
+	if v.PersonalCustomerID != nil {
+		id := strings.TrimSpace(*v.PersonalCustomerID)
+		if id == "" {
+			v.PersonalCustomerID = nil
+		} else {
+			if len(id) > maxCustomerIDLength {
+				return common.NewValidationError(fmt.Sprintf("personal_customer_id must be at most %d characters", maxCustomerIDLength), nil)
+			}
+			v.PersonalCustomerID = &id
+		}
+	}
+
+	for _, list := range allowlists {
+		values := list.values(v)
+		if *values == nil {
+			continue
+		}
+		normalized, err := normalizeAllowlist(list.field, *values)
+		if err != nil {
+			return common.NewValidationError(err.Error(), nil)
+		}
+		*values = normalized
+	}
+
+	if v.PersonalCustomerID == nil {
+		return nil
+	}
+	if appErr := checkPersonalAllowlists(*v); appErr != nil {
+		return appErr
+	}
+	if v.MaxRedemptions == nil {
+		single := 1
+		v.MaxRedemptions = &single
+	} else if *v.MaxRedemptions != 1 {
+		return common.NewValidationError("a personal voucher is single-use, max_redemptions must be 1", nil)
+	}
+	return nil
+}
+
+// checkPersonalAllowlists rejects a personal voucher that also has
+// allowlists.
+func checkPersonalAllowlists(v Voucher) *common.AppError {
+	if v.PersonalCustomerID != nil && (len(v.AllowedCustomerIDs) > 0 || len(v.AllowedEmailHashes) > 0) {
+		return common.NewValidationError("a personal voucher cannot also have allowed_customer_ids or allowed_email_hashes", nil)
+	}
+	return nil
+}
+
+// checkReplacedTargeting checks the customer targeting current ends up with
+// when it is replaced by v. Allowlists omitted from v are left unchanged by
+// the update, so they are taken from current.
+func checkReplacedTargeting(current, v Voucher) *common.AppError {
+	merged := v
+	for _, list := range allowlists {
+		if *list.values(&merged) == nil {
+			*list.values(&merged) = *list.values(&current)
+		}
+	}
+	return checkPersonalAllowlists(merged)
+}
+
+func normalizeAllowlist(field string, raw []string) ([]string, error) {
+	seen := make(map[string]struct{}, len(raw))
+	values := make([]string, 0, len(raw))
+	for _, value := range raw {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		if field == "allowed_email_hashes" {
+			value = strings.ToLower(value)
+			if _, err := hex.DecodeString(value); err != nil || len(value) != sha256.Size*2 {
+				return nil, fmt.Errorf("allowed_email_hashes value %q must be a hex SHA-256 hash", value)
+			}
+		}
+		if len(value) > maxCustomerIDLength {
+			return nil, fmt.Errorf("%s value %q must be at most %d characters", field, value, maxCustomerIDLength)
+		}
+		if strings.Contains(value, csvListSeparator) {
+			return nil, fmt.Errorf("%s value %q must not contain %q", field, value, csvListSeparator)
+		}
+		if _, ok := seen[value]; ok {
+			continue
+		}
+		seen[value] = struct{}{}
+		values = append(values, value)
+	}
+	if len(values) > maxAllowlistSize {
+		return nil, fmt.Errorf("%s can have at most %d values", field, maxAllowlistSize)
+	}
+	sort.Strings(values)
+	return values, nil
+}
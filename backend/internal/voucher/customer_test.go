@@ -0,0 +1,65 @@
+package voucher
+
+import "testing"
+
+func TestCheckReplacedTargeting(t *testing.T) {
+	personal := "CUST-42"
+	allowlisted := Voucher{AllowedCustomerIDs: []string{"CUST-1"}}
+	hashed := Voucher{AllowedEmailHashes: []string{hashEmail("ana@example.com")}}
+
+	tests := []struct {
+		name    string
+		current Voucher
+		update  Voucher
+		wantErr bool
+	}{
+		{
+			// PUT omits the allowlists, which the repository keeps.
+			name:    "personal id on allowlisted voucher",
+			current: allowlisted,
+			update:  Voucher{PersonalCustomerID: &personal},
+			wantErr: true,
+		},
+		{
+			name:    "personal id on voucher with email hashes",
+			current: hashed,
+			update:  Voucher{PersonalCustomerID: &personal},
+			wantErr: true,
+		},
+		{
+			name:    "personal id clearing the allowlists",
+			current: allowlisted,
+			update:  Voucher{PersonalCustomerID: &personal, AllowedCustomerIDs: []string{}, AllowedEmailHashes: []string{}},
+		},
+		{
+			name:    "personal id clearing only one allowlist",
+			current: Voucher{AllowedCustomerIDs: []string{"CUST-1"}, AllowedEmailHashes: hashed.AllowedEmailHashes},
+			update:  Voucher{PersonalCustomerID: &personal, AllowedCustomerIDs: []string{}},
+			wantErr: true,
+		},
+		{
+			name:    "allowlist added to personal voucher",
+			current: Voucher{PersonalCustomerID: &personal},
+			update:  Voucher{PersonalCustomerID: &personal, AllowedCustomerIDs: []string{"CUST-1"}},
+			wantErr: true,
+		},
+		{
+			name:    "personal id removed while allowlist kept",
+			current: Voucher{PersonalCustomerID: &personal},
+			update:  Voucher{AllowedCustomerIDs: []string{"CUST-1"}},
+		},
+		{
+			name:    "untargeted",
+			current: Voucher{},
+			update:  Voucher{PersonalCustomerID: &personal},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			appErr := checkReplacedTargeting(tt.current, tt.update)
+			if (appErr != nil) != tt.wantErr {
+				t.Fatalf("checkReplacedTargeting error = %v, want error %v", appErr, tt.wantErr)
+			}
+		})
+	}
+}
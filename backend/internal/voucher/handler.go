@@ -1,6 +1,7 @@
 package voucher
 
 import (
+	"encoding/json"
 	"net/http"
 	"strconv"
 	"strings"
@@ -19,27 +20,28 @@ func NewHandler(service *Service) *Handler {
 }
 
 func (h *Handler) List(c *gin.Context) {
-	limit := parseQueryInt(c, "limit", 10)
-	page := parseQueryInt(c, "page", 1)
-	if page < 1 {
-		page = 1
-	}
-	if limit <= 0 {
-		limit = 10
+	params, appErr := parseListParams(c)
+	if appErr != nil {
+		response.Error(c, appErr)
+		return
 	}
-	if limit > 100 {
-		limit = 100
+
+	result, appErr := h.service.List(c.Request.Context(), params)
+	if appErr != nil {
+		response.Error(c, appErr)
+		return
 	}
 
-	offset := (page - 1) * limit
+	response.Success(c, http.StatusOK, result)
+}
 
-	params := ListParams{
-		Search: c.Query("q"),
-		SortBy: strings.TrimSpace(c.DefaultQuery("sort", "expiry_date")),
-		Order:  strings.TrimSpace(c.DefaultQuery("order", "asc")),
-		Limit:  int32(limit),
-		Offset: int32(offset),
+func (h *Handler) Trash(c *gin.Context) {
+	params, appErr := parseListParams(c)
+	if appErr != nil {
+		response.Error(c, appErr)
+		return
 	}
+	params.Trashed = true
 
 	result, appErr := h.service.List(c.Request.Context(), params)
 	if appErr != nil {
@@ -63,6 +65,7 @@ func (h *Handler) Create(c *gin.Context) {
 		return
 	}
 
+	setETag(c, created)
 	response.Success(c, http.StatusCreated, created)
 }
 
@@ -79,6 +82,17 @@ func (h *Handler) Get(c *gin.Context) {
 		return
 	}
 
+	setETag(c, voucher)
+	response.Success(c, http.StatusOK, voucher)
+}
+
+func (h *Handler) Lookup(c *gin.Context) {
+	voucher, appErr := h.service.Lookup(c.Request.Context(), c.Query("code"))
+	if appErr != nil {
+		response.Error(c, appErr)
+		return
+	}
+
 	response.Success(c, http.StatusOK, voucher)
 }
 
@@ -95,15 +109,109 @@ func (h *Handler) Update(c *gin.Context) {
 		return
 	}
 
-	updated, err := h.service.Update(c.Request.Context(), id, input)
+	updated, err := h.service.Update(c.Request.Context(), id, input, parseIfMatch(c))
 	if err != nil {
 		response.Error(c, err)
 		return
 	}
 
+	setETag(c, updated)
 	response.Success(c, http.StatusOK, updated)
 }
 
+// Patch accepts a JSON Merge Patch (RFC 7396). Plain application/json is
+// accepted too and treated the same way.
+func (h *Handler) Patch(c *gin.Context) {
+	id, appErr := parseIDParam(c)
+	if appErr != nil {
+		response.Error(c, appErr)
+		return
+	}
+
+	switch c.ContentType() {
+	case MergePatchContentType, "application/json":
+	default:
+		response.Error(c, common.NewAppError(http.StatusUnsupportedMediaType, "Content-Type must be "+MergePatchContentType, nil))
+		return
+	}
+
+	var patch VoucherPatch
+	if err := json.NewDecoder(c.Request.Body).Decode(&patch); err != nil || patch == nil {
+		response.Error(c, common.NewValidationError("request body must be a JSON object", err))
+		return
+	}
+
+	updated, appErr := h.service.Patch(c.Request.Context(), id, patch, parseIfMatch(c))
+	if appErr != nil {
+		response.Error(c, appErr)
+		return
+	}
+
+	setETag(c, updated)
+	response.Success(c, http.StatusOK, updated)
+}
+
+func (h *Handler) Clone(c *gin.Context) {
+	id, appErr := parseIDParam(c)
+	if appErr != nil {
+		response.Error(c, appErr)
+		return
+	}
+
+	var input CloneVoucherInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		response.Error(c, validationError(err))
+		return
+	}
+
+	result, appErr := h.service.Clone(c.Request.Context(), id, input)
+	if appErr != nil {
+		response.Error(c, appErr)
+		return
+	}
+
+	response.Success(c, http.StatusOK, result)
+}
+
+func (h *Handler) Versions(c *gin.Context) {
+	id, appErr := parseIDParam(c)
+	if appErr != nil {
+		response.Error(c, appErr)
+		return
+	}
+
+	versions, appErr := h.service.ListVersions(c.Request.Context(), id)
+	if appErr != nil {
+		response.Error(c, appErr)
+		return
+	}
+
+	response.Success(c, http.StatusOK, versions)
+}
+
+func (h *Handler) Revert(c *gin.Context) {
+	id, appErr := parseIDParam(c)
+	if appErr != nil {
+		response.Error(c, appErr)
+		return
+	}
+
+	var input RevertVoucherInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		response.Error(c, validationError(err))
+		return
+	}
+
+	reverted, appErr := h.service.Revert(c.Request.Context(), id, input, parseIfMatch(c))
+	if appErr != nil {
+		response.Error(c, appErr)
+		return
+	}
+
+	setETag(c, reverted)
+	response.Success(c, http.StatusOK, reverted)
+}
+
 func (h *Handler) Delete(c *gin.Context) {
 	id, appErr := parseIDParam(c)
 	if appErr != nil {
@@ -111,7 +219,39 @@ func (h *Handler) Delete(c *gin.Context) {
 		return
 	}
 
-	if err := h.service.Delete(c.Request.Context(), id); err != nil {
+	if err := h.service.Delete(c.Request.Context(), id, parseIfMatch(c)); err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *Handler) Restore(c *gin.Context) {
+	id, appErr := parseIDParam(c)
+	if appErr != nil {
+		response.Error(c, appErr)
+		return
+	}
+
+	restored, err := h.service.Restore(c.Request.Context(), id)
+	if err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	setETag(c, restored)
+	response.Success(c, http.StatusOK, restored)
+}
+
+func (h *Handler) Purge(c *gin.Context) {
+	id, appErr := parseIDParam(c)
+	if appErr != nil {
+		response.Error(c, appErr)
+		return
+	}
+
+	if err := h.service.Purge(c.Request.Context(), id); err != nil {
 		response.Error(c, err)
 		return
 	}
@@ -119,6 +259,159 @@ func (h *Handler) Delete(c *gin.Context) {
 	c.Status(http.StatusNoContent)
 }
 
+func (h *Handler) Transition(c *gin.Context) {
+	id, appErr := parseIDParam(c)
+	if appErr != nil {
+		response.Error(c, appErr)
+		return
+	}
+
+	var input TransitionVoucherInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		response.Error(c, validationError(err))
+		return
+	}
+
+	updated, err := h.service.Transition(c.Request.Context(), id, input, parseIfMatch(c))
+	if err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	setETag(c, updated)
+	response.Success(c, http.StatusOK, updated)
+}
+
+func (h *Handler) Generate(c *gin.Context) {
+	var input GenerateVouchersInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		response.Error(c, validationError(err))
+		return
+	}
+
+	result, appErr := h.service.Generate(c.Request.Context(), input)
+	if appErr != nil {
+		response.Error(c, appErr)
+		return
+	}
+
+	response.Success(c, http.StatusCreated, result)
+}
+
+// Reserve is mounted under /vouchers/:id so it can share the wildcard with
+// the other voucher routes; the parameter holds the voucher code here.
+func (h *Handler) Reserve(c *gin.Context) {
+	var input ReserveVoucherInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		response.Error(c, validationError(err))
+		return
+	}
+
+	reservation, appErr := h.service.Reserve(c.Request.Context(), c.Param("id"), input)
+	if appErr != nil {
+		response.Error(c, appErr)
+		return
+	}
+
+	response.Success(c, http.StatusCreated, reservation)
+}
+
+func (h *Handler) GetReservation(c *gin.Context) {
+	id, appErr := parseReservationIDParam(c)
+	if appErr != nil {
+		response.Error(c, appErr)
+		return
+	}
+
+	reservation, appErr := h.service.GetReservation(c.Request.Context(), id)
+	if appErr != nil {
+		response.Error(c, appErr)
+		return
+	}
+
+	response.Success(c, http.StatusOK, reservation)
+}
+
+func (h *Handler) ConfirmReservation(c *gin.Context) {
+	id, appErr := parseReservationIDParam(c)
+	if appErr != nil {
+		response.Error(c, appErr)
+		return
+	}
+
+	redemption, appErr := h.service.ConfirmReservation(c.Request.Context(), id)
+	if appErr != nil {
+		response.Error(c, appErr)
+		return
+	}
+
+	response.Success(c, http.StatusCreated, redemption)
+}
+
+func (h *Handler) ReleaseReservation(c *gin.Context) {
+	id, appErr := parseReservationIDParam(c)
+	if appErr != nil {
+		response.Error(c, appErr)
+		return
+	}
+
+	reservation, appErr := h.service.ReleaseReservation(c.Request.Context(), id)
+	if appErr != nil {
+		response.Error(c, appErr)
+		return
+	}
+
+	response.Success(c, http.StatusOK, reservation)
+}
+
+func (h *Handler) Evaluate(c *gin.Context) {
+	var input EvaluateVouchersInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		response.Error(c, validationError(err))
+		return
+	}
+
+	result, appErr := h.service.Evaluate(c.Request.Context(), input)
+	if appErr != nil {
+		response.Error(c, appErr)
+		return
+	}
+
+	response.Success(c, http.StatusOK, result)
+}
+
+func (h *Handler) Calculate(c *gin.Context) {
+	var input CalculateDiscountInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		response.Error(c, validationError(err))
+		return
+	}
+
+	result, appErr := h.service.Calculate(c.Request.Context(), input)
+	if appErr != nil {
+		response.Error(c, appErr)
+		return
+	}
+
+	response.Success(c, http.StatusOK, result)
+}
+
+func (h *Handler) Redeem(c *gin.Context) {
+	var input RedeemVoucherInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		response.Error(c, validationError(err))
+		return
+	}
+
+	redemption, appErr := h.service.Redeem(c.Request.Context(), input)
+	if appErr != nil {
+		response.Error(c, appErr)
+		return
+	}
+
+	response.Success(c, http.StatusCreated, redemption)
+}
+
 func (h *Handler) UploadCSV(c *gin.Context) {
 	file, err := c.FormFile("file")
 	if err != nil {
@@ -146,6 +439,53 @@ func (h *Handler) Export(c *gin.Context) {
 	c.Data(http.StatusOK, "text/csv", data)
 }
 
+func (h *Handler) ListTags(c *gin.Context) {
+	tags, appErr := h.service.ListTags(c.Request.Context())
+	if appErr != nil {
+		response.Error(c, appErr)
+		return
+	}
+
+	response.Success(c, http.StatusOK, tags)
+}
+
+func parseListParams(c *gin.Context) (ListParams, *common.AppError) {
+	limit := parseQueryInt(c, "limit", 10)
+	page := parseQueryInt(c, "page", 1)
+	if page < 1 {
+		page = 1
+	}
+	if limit <= 0 {
+		limit = 10
+	}
+	if limit > 100 {
+		limit = 100
+	}
+
+	offset := (page - 1) * limit
+
+	params := ListParams{
+		Search: c.Query("q"),
+		Status: strings.TrimSpace(c.Query("status")),
+		State:  strings.TrimSpace(c.Query("state")),
+		SortBy: strings.TrimSpace(c.DefaultQuery("sort", "expiry_date")),
+		Order:  strings.TrimSpace(c.DefaultQuery("order", "asc")),
+		Tags:   c.QueryArray("tag"),
+		Limit:  int32(limit),
+		Offset: int32(offset),
+	}
+
+	if raw := c.Query("campaign_id"); raw != "" {
+		campaignID, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || campaignID <= 0 {
+			return ListParams{}, common.NewValidationError("invalid campaign_id", err)
+		}
+		params.CampaignID = &campaignID
+	}
+
+	return params, nil
+}
+
 func parseQueryInt(c *gin.Context, key string, fallback int) int {
 	valueStr := c.Query(key)
 	if valueStr == "" {
@@ -169,6 +509,46 @@ func parseIDParam(c *gin.Context) (int64, *common.AppError) {
 	return id, nil
 }
 
+func parseReservationIDParam(c *gin.Context) (int64, *common.AppError) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || id <= 0 {
+		return 0, common.NewValidationError("invalid reservation id", err)
+	}
+	return id, nil
+}
+
+// setETag exposes the voucher version as a strong ETag, e.g. "3".
+func setETag(c *gin.Context, v Voucher) {
+	c.Header("ETag", strconv.Quote(strconv.Itoa(v.Version)))
+}
+
+// parseIfMatch reads the If-Match header. Entries that are not ETags issued
+// by setETag are ignored, so a header containing only such entries matches
+// no version. Weak ETags never match, as If-Match uses strong comparison.
+func parseIfMatch(c *gin.Context) IfMatch {
+	header := strings.TrimSpace(c.GetHeader("If-Match"))
+	if header == "" {
+		return IfMatch{}
+	}
+
+	ifMatch := IfMatch{Present: true, Versions: []int{}}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			ifMatch.Any = true
+			continue
+		}
+		unquoted, err := strconv.Unquote(tag)
+		if err != nil {
+			continue
+		}
+		if version, err := strconv.Atoi(unquoted); err == nil {
+			ifMatch.Versions = append(ifMatch.Versions, version)
+		}
+	}
+	return ifMatch
+}
+
 func validationError(err error) *common.AppError {
 	return common.NewValidationError("invalid request payload", err)
 }
@@ -0,0 +1,46 @@
+package voucher
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestParseIfMatch(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name      string
+		header    string
+		want      IfMatch
+		matchesV3 bool
+	}{
+		{"absent", "", IfMatch{}, true},
+		{"strong tag", `"3"`, IfMatch{Present: true, Versions: []int{3}}, true},
+		{"several tags", `"2", "3"`, IfMatch{Present: true, Versions: []int{2, 3}}, true},
+		{"any", "*", IfMatch{Present: true, Any: true, Versions: []int{}}, true},
+		{"weak tag", `W/"3"`, IfMatch{Present: true, Versions: []int{}}, false},
+		{"weak tag next to strong tag", `W/"3", "4"`, IfMatch{Present: true, Versions: []int{4}}, false},
+		{"foreign tag", `"abc"`, IfMatch{Present: true, Versions: []int{}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodPut, "/vouchers/1", nil)
+			if tt.header != "" {
+				c.Request.Header.Set("If-Match", tt.header)
+			}
+
+			got := parseIfMatch(c)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("parseIfMatch(%q) = %+v, want %+v", tt.header, got, tt.want)
+			}
+			if got.matches(3) != tt.matchesV3 {
+				t.Fatalf("parseIfMatch(%q).matches(3) = %v, want %v", tt.header, got.matches(3), tt.matchesV3)
+			}
+		})
+	}
+}
@@ -1,20 +1,121 @@
 package voucher
 
+import "errors"
+
+const (
+	DiscountTypePercent     = "percent"
+	DiscountTypeFixedAmount = "fixed_amount"
+)
+
+// Status is derived from the validity window (valid_from..expiry_date, both
+// inclusive, in the voucher's time zone) at query time and is never stored.
+const (
+	StatusScheduled = "scheduled"
+	StatusActive    = "active"
+	StatusExpired   = "expired"
+)
+
+// State is the lifecycle state set explicitly by staff, independent of the
+// date-derived Status. Only active vouchers can be redeemed.
+const (
+	StateDraft    = "draft"
+	StateActive   = "active"
+	StatePaused   = "paused"
+	StateArchived = "archived"
+)
+
+// stateTransitions lists, for each state, the states it may move to.
+// Archived is terminal.
+var stateTransitions = map[string][]string{
+	StateDraft:    {StateActive, StateArchived},
+	StateActive:   {StatePaused, StateArchived},
+	StatePaused:   {StateActive, StateArchived},
+	StateArchived: {},
+}
+
+// Voucher amounts (DiscountAmount, MinOrderAmount, MaxDiscountAmount and the
+// order amounts used when redeeming) are expressed in the minor unit of
+// Currency. DiscountPercent is 0 for
+// fixed_amount vouchers and DiscountAmount is 0 for percent vouchers.
 type Voucher struct {
-	ID              int64  `json:"id" db:"id"`
-	VoucherCode     string `json:"voucher_code" db:"voucher_code"`
-	DiscountPercent int    `json:"discount_percent" db:"discount_percent"`
-	ExpiryDate      string `json:"expiry_date" db:"expiry_date"`
-	CreatedAt       string `json:"created_at" db:"created_at"`
-	UpdatedAt       string `json:"updated_at" db:"updated_at"`
+	ID                        int64    `json:"id" db:"id"`
+	VoucherCode               string   `json:"voucher_code" db:"voucher_code"`
+	DiscountType              string   `json:"discount_type" db:"discount_type"`
+	DiscountPercent           int      `json:"discount_percent" db:"discount_percent"`
+	DiscountAmount            int64    `json:"discount_amount" db:"discount_amount"`
+	Currency                  string   `json:"currency" db:"currency"`
+	MinOrderAmount            *int64   `json:"min_order_amount" db:"min_order_amount"`
+	MaxDiscountAmount         *int64   `json:"max_discount_amount" db:"max_discount_amount"`
+	ValidFrom                 string   `json:"valid_from" db:"valid_from"`
+	ExpiryDate                string   `json:"expiry_date" db:"expiry_date"`
+	Timezone                  *string  `json:"timezone" db:"timezone"`
+	ExpiresAt                 string   `json:"expires_at" db:"expires_at"`
+	Status                    string   `json:"status" db:"status"`
+	State                     string   `json:"state" db:"state"`
+	CampaignID                *int64   `json:"campaign_id" db:"campaign_id"`
+	Tags                      []string `json:"tags" db:"tags"`
+	MaxRedemptions            *int     `json:"max_redemptions" db:"max_redemptions"`
+	MaxRedemptionsPerCustomer *int     `json:"max_redemptions_per_customer" db:"max_redemptions_per_customer"`
+	Stackable                 bool     `json:"stackable" db:"stackable"`
+	ExclusivityGroup          *string  `json:"exclusivity_group" db:"exclusivity_group"`
+	PersonalCustomerID        *string  `json:"personal_customer_id" db:"personal_customer_id"`
+	AllowedCustomerIDs        []string `json:"allowed_customer_ids" db:"allowed_customer_ids"`
+	AllowedEmailHashes        []string `json:"allowed_email_hashes" db:"allowed_email_hashes"`
+	IncludeSKUs               []string `json:"include_skus" db:"include_skus"`
+	ExcludeSKUs               []string `json:"exclude_skus" db:"exclude_skus"`
+	IncludeCategories         []string `json:"include_categories" db:"include_categories"`
+	ExcludeCategories         []string `json:"exclude_categories" db:"exclude_categories"`
+	RedemptionCount           int      `json:"redemption_count" db:"redemption_count"`
+	Version                   int      `json:"version" db:"version"`
+	CreatedAt                 string   `json:"created_at" db:"created_at"`
+	UpdatedAt                 string   `json:"updated_at" db:"updated_at"`
+	DeletedAt                 *string  `json:"deleted_at,omitempty" db:"deleted_at"`
+}
+
+// IfMatch is a parsed If-Match request header. Present is false when the
+// header was not sent; Any is set for "*". Versions lists the voucher
+// versions the client accepts.
+type IfMatch struct {
+	Present  bool
+	Any      bool
+	Versions []int
+}
+
+func (m IfMatch) matches(version int) bool {
+	if !m.Present || m.Any {
+		return true
+	}
+	for _, v := range m.Versions {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
+
+// versions returns the versions an update must match, or nil when the update
+// is unconditional.
+func (m IfMatch) versions() []int {
+	if !m.Present || m.Any {
+		return nil
+	}
+	if m.Versions == nil {
+		return []int{}
+	}
+	return m.Versions
 }
 
 type ListParams struct {
-	Search string
-	SortBy string
-	Order  string
-	Limit  int32
-	Offset int32
+	Search     string
+	Status     string
+	State      string
+	CampaignID *int64
+	Tags       []string
+	Trashed    bool
+	SortBy     string
+	Order      string
+	Limit      int32
+	Offset     int32
 }
 
 type PaginationMeta struct {
@@ -28,3 +129,88 @@ type ListResponse struct {
 	Data       []Voucher      `json:"data"`
 	Pagination PaginationMeta `json:"pagination"`
 }
+
+const (
+	maxTagLength      = 50
+	maxTagsPerVoucher = 20
+)
+
+const (
+	maxScopeValueLength   = 100
+	maxScopeValuesPerList = 500
+	maxCartLines          = 500
+)
+
+const maxTimezoneLength = 64
+
+const (
+	maxCustomerIDLength = 255
+	maxAllowlistSize    = 10000
+)
+
+const (
+	defaultGeneratedCodeLength = 8
+	maxCodePrefixLength        = 20
+	// generatedCodeSpaceFactor is how much larger the code space must be
+	// than the number of codes requested.
+	generatedCodeSpaceFactor = 100
+	// generateBatchSize vouchers are inserted, audited and committed at a
+	// time; maxGenerateRounds batches may come up short on collisions
+	// before generation gives up.
+	generateBatchSize = 5000
+	maxGenerateRounds = 10
+)
+
+var errGenerateExhausted = errors.New("unique code generation exhausted")
+
+type Tag struct {
+	Name       string `json:"name"`
+	UsageCount int    `json:"usage_count"`
+}
+
+// VoucherVersion is a voucher as it was before an update replaced it.
+// ReplacedAt is when that happened.
+type VoucherVersion struct {
+	Version    int     `json:"version"`
+	Voucher    Voucher `json:"voucher"`
+	ReplacedAt string  `json:"replaced_at"`
+}
+
+type Redemption struct {
+	ID             int64  `json:"id"`
+	VoucherID      int64  `json:"voucher_id"`
+	VoucherCode    string `json:"voucher_code"`
+	CustomerID     string `json:"customer_id,omitempty"`
+	OrderReference string `json:"order_reference"`
+	OrderAmount    int64  `json:"order_amount"`
+	DiscountAmount int64  `json:"discount_amount"`
+	FinalAmount    int64  `json:"final_amount"`
+	RedeemedAt     string `json:"redeemed_at"`
+}
+
+// Reservation statuses. A held reservation whose expires_at has passed is
+// reported as expired even before the sweeper updates the stored status.
+const (
+	ReservationHeld      = "held"
+	ReservationConfirmed = "confirmed"
+	ReservationReleased  = "released"
+	ReservationExpired   = "expired"
+)
+
+// Reservation holds one use of a voucher during checkout. Amounts are priced
+// when the hold is taken and copied onto the redemption on confirm.
+type Reservation struct {
+	ID             int64  `json:"id"`
+	VoucherID      int64  `json:"voucher_id"`
+	VoucherCode    string `json:"voucher_code"`
+	CustomerID     string `json:"customer_id,omitempty"`
+	OrderReference string `json:"order_reference"`
+	OrderAmount    int64  `json:"order_amount"`
+	DiscountAmount int64  `json:"discount_amount"`
+	FinalAmount    int64  `json:"final_amount"`
+	Status         string `json:"status"`
+	ExpiresAt      string `json:"expires_at"`
+	RedemptionID   *int64 `json:"redemption_id"`
+	CreatedAt      string `json:"created_at"`
+	UpdatedAt      string `json:"updated_at"`
+}
@@ -0,0 +1,156 @@
+package voucher
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/mhakimsaputra17/discount-voucher-management/backend/internal/common"
+)
+
+// MergePatchContentType is the media type of a JSON Merge Patch (RFC 7396).
+const MergePatchContentType = "application/merge-patch+json"
+
+// VoucherPatch is a JSON Merge Patch document for a voucher: a field that is
+// absent is left unchanged and a field set to null is cleared.
+type VoucherPatch map[string]json.RawMessage
+
+// patchFields maps every patchable field to the function applying it. Fields
+// not listed here, such as state, cannot be patched.
+var patchFields = map[string]func(v *Voucher, raw json.RawMessage) error{
+	"voucher_code": func(v *Voucher, raw json.RawMessage) error {
+		return decodeRequired(raw, &v.VoucherCode)
+	},
+	"discount_type": func(v *Voucher, raw json.RawMessage) error {
+		return decodeRequired(raw, &v.DiscountType)
+	},
+	"discount_percent": func(v *Voucher, raw json.RawMessage) error {
+		v.DiscountPercent = 0
+		return decodeNullable(raw, &v.DiscountPercent)
+	},
+	"discount_amount": func(v *Voucher, raw json.RawMessage) error {
+		v.DiscountAmount = 0
+		return decodeNullable(raw, &v.DiscountAmount)
+	},
+	"currency": func(v *Voucher, raw json.RawMessage) error {
+		return decodeRequired(raw, &v.Currency)
+	},
+	"min_order_amount": func(v *Voucher, raw json.RawMessage) error {
+		return decodeNullable(raw, &v.MinOrderAmount)
+	},
+	"max_discount_amount": func(v *Voucher, raw json.RawMessage) error {
+		return decodeNullable(raw, &v.MaxDiscountAmount)
+	},
+	"valid_from": func(v *Voucher, raw json.RawMessage) error {
+		return decodeRequired(raw, &v.ValidFrom)
+	},
+	"expiry_date": func(v *Voucher, raw json.RawMessage) error {
+		return decodeRequired(raw, &v.ExpiryDate)
+	},
+	"timezone": func(v *Voucher, raw json.RawMessage) error {
+		return decodeNullable(raw, &v.Timezone)
+	},
+	"campaign_id": func(v *Voucher, raw json.RawMessage) error {
+		return decodeNullable(raw, &v.CampaignID)
+	},
+	"max_redemptions": func(v *Voucher, raw json.RawMessage) error {
+		return decodeNullable(raw, &v.MaxRedemptions)
+	},
+	"max_redemptions_per_customer": func(v *Voucher, raw json.RawMessage) error {
+		return decodeNullable(raw, &v.MaxRedemptionsPerCustomer)
+	},
+	"stackable": func(v *Voucher, raw json.RawMessage) error {
+		return decodeRequired(raw, &v.Stackable)
+	},
+	"exclusivity_group": func(v *Voucher, raw json.RawMessage) error {
+		return decodeNullable(raw, &v.ExclusivityGroup)
+	},
+	"personal_customer_id": func(v *Voucher, raw json.RawMessage) error {
+		return decodeNullable(raw, &v.PersonalCustomerID)
+	},
+	"allowed_customer_ids": patchList(func(v *Voucher) *[]string { return &v.AllowedCustomerIDs }),
+	"allowed_email_hashes": patchList(func(v *Voucher) *[]string { return &v.AllowedEmailHashes }),
+	"include_skus":         patchList(func(v *Voucher) *[]string { return &v.IncludeSKUs }),
+	"exclude_skus":         patchList(func(v *Voucher) *[]string { return &v.ExcludeSKUs }),
+	"include_categories":   patchList(func(v *Voucher) *[]string { return &v.IncludeCategories }),
+	"exclude_categories":   patchList(func(v *Voucher) *[]string { return &v.ExcludeCategories }),
+	"tags": func(v *Voucher, raw json.RawMessage) error {
+		if err := decodeNullable(raw, &v.Tags); err != nil {
+			return err
+		}
+		if v.Tags == nil {
+			// nil would mean "leave tags unchanged".
+			v.Tags = []string{}
+		}
+		return nil
+	},
+}
+
+// apply merges the patch into v, which must hold the voucher's current
+// attributes. Only the shape of each supplied value is checked here; the
+// merged voucher is validated as a whole by prepareVoucher.
+func (p VoucherPatch) apply(v *Voucher) *common.AppError {
+	fields := make([]string, 0, len(p))
+	for field := range p {
+		if _, ok := patchFields[field]; !ok {
+			return common.NewValidationError(fmt.Sprintf("field %q cannot be patched", field), nil)
+		}
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	// Tags are only rewritten when the patch mentions them.
+	v.Tags = nil
+	for _, field := range fields {
+		if err := patchFields[field](v, p[field]); err != nil {
+			return common.NewValidationError(fmt.Sprintf("invalid value for %s", field), err)
+		}
+	}
+
+	// Switching discount_type drops the amount of the old type unless the
+	// patch sets it explicitly, so {"discount_type": "fixed_amount",
+	// "discount_amount": 5000} is enough to convert a percent voucher.
+	if _, ok := p["discount_type"]; ok {
+		if _, ok := p["discount_percent"]; !ok && v.DiscountType != DiscountTypePercent {
+			v.DiscountPercent = 0
+		}
+		if _, ok := p["discount_amount"]; !ok && v.DiscountType != DiscountTypeFixedAmount {
+			v.DiscountAmount = 0
+		}
+	}
+
+	return nil
+}
+
+// patchList applies a list field; null clears it like an empty list.
+func patchList(values func(v *Voucher) *[]string) func(v *Voucher, raw json.RawMessage) error {
+	return func(v *Voucher, raw json.RawMessage) error {
+		dst := values(v)
+		if err := decodeNullable(raw, dst); err != nil {
+			return err
+		}
+		if *dst == nil {
+			*dst = []string{}
+		}
+		return nil
+	}
+}
+
+func decodeRequired(raw json.RawMessage, dst any) error {
+	if isJSONNull(raw) {
+		return errors.New("value cannot be null")
+	}
+	return json.Unmarshal(raw, dst)
+}
+
+// decodeNullable decodes raw into dst. null sets pointers and slices to nil
+// and leaves other values untouched, so callers reset those first.
+func decodeNullable(raw json.RawMessage, dst any) error {
+	return json.Unmarshal(raw, dst)
+}
+
+func isJSONNull(raw json.RawMessage) bool {
+	return bytes.Equal(bytes.TrimSpace(raw), []byte("null"))
+}
@@ -0,0 +1,178 @@
+package voucher
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/mhakimsaputra17/discount-voucher-management/backend/internal/common"
+	"github.com/mhakimsaputra17/discount-voucher-management/backend/internal/config"
+	"github.com/mhakimsaputra17/discount-voucher-management/backend/internal/database"
+	"github.com/mhakimsaputra17/discount-voucher-management/backend/internal/logger"
+)
+
+const concurrentRedemptions = 20
+
+// newTestService connects to the migrated database in TEST_DATABASE_URL and
+// skips the test when it is not set.
+func newTestService(t *testing.T) (*Service, *pgxpool.Pool) {
+	t.Helper()
+
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	cfg := config.Config{
+		DatabaseURL:      url,
+		DatabaseMaxConns: concurrentRedemptions + 2,
+		DatabaseMinConns: 1,
+		QueryTimeout:     30 * time.Second,
+		VoucherCodeCase:  "upper",
+		BusinessTimezone: "UTC",
+	}
+	pool, err := database.Connect(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(pool.Close)
+
+	return NewService(NewRepository(pool), nil, cfg, logger.New("test")), pool
+}
+
+// createLimitedVoucher creates an active voucher with the given limits and
+// removes it together with its redemptions when the test ends.
+func createLimitedVoucher(t *testing.T, svc *Service, pool *pgxpool.Pool, maxTotal, maxPerCustomer *int) Voucher {
+	t.Helper()
+
+	v, appErr := svc.Create(context.Background(), CreateVoucherInput{
+		VoucherCode:               fmt.Sprintf("RACE%d", time.Now().UnixNano()),
+		DiscountType:              DiscountTypeFixedAmount,
+		DiscountAmount:            1000,
+		ExpiryDate:                time.Now().AddDate(1, 0, 0).Format("2006-01-02"),
+		MaxRedemptions:            maxTotal,
+		MaxRedemptionsPerCustomer: maxPerCustomer,
+	})
+	if appErr != nil {
+		t.Fatalf("create voucher: %v", appErr)
+	}
+	t.Cleanup(func() {
+		ctx := context.Background()
+		_, _ = pool.Exec(ctx, `DELETE FROM voucher_redemptions WHERE voucher_id = $1`, v.ID)
+		_, _ = pool.Exec(ctx, `DELETE FROM vouchers WHERE id = $1`, v.ID)
+	})
+	return v
+}
+
+// redeemConcurrently redeems code from concurrentRedemptions goroutines at
+// once, each for its own order, and returns the errors in no particular order.
+func redeemConcurrently(svc *Service, code string, customerID func(i int) string) []*common.AppError {
+	var (
+		wg    sync.WaitGroup
+		start = make(chan struct{})
+		errs  = make([]*common.AppError, concurrentRedemptions)
+	)
+	for i := 0; i < concurrentRedemptions; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			_, errs[i] = svc.Redeem(context.Background(), RedeemVoucherInput{
+				VoucherCode:    code,
+				CustomerID:     customerID(i),
+				OrderReference: fmt.Sprintf("%s-order-%d", code, i),
+				OrderAmount:    50000,
+			})
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+	return errs
+}
+
+func TestRedeemConcurrentLimits(t *testing.T) {
+	svc, pool := newTestService(t)
+	one := 1
+
+	tests := []struct {
+		name           string
+		maxTotal       *int
+		maxPerCustomer *int
+		customerID     func(i int) string
+		wantMessage    string
+	}{
+		{
+			name:        "max_redemptions",
+			maxTotal:    &one,
+			customerID:  func(i int) string { return fmt.Sprintf("customer-%d", i) },
+			wantMessage: "voucher redemption limit reached",
+		},
+		{
+			name:           "max_redemptions_per_customer",
+			maxPerCustomer: &one,
+			customerID:     func(int) string { return "customer-1" },
+			wantMessage:    "customer redemption limit reached for this voucher",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := createLimitedVoucher(t, svc, pool, tt.maxTotal, tt.maxPerCustomer)
+
+			succeeded := 0
+			for _, appErr := range redeemConcurrently(svc, v.VoucherCode, tt.customerID) {
+				switch {
+				case appErr == nil:
+					succeeded++
+				case appErr.StatusCode != http.StatusUnprocessableEntity || appErr.Message != tt.wantMessage:
+					t.Errorf("redeem error = %d %q, want %d %q", appErr.StatusCode, appErr.Message, http.StatusUnprocessableEntity, tt.wantMessage)
+				}
+			}
+			if succeeded != 1 {
+				t.Fatalf("%d redemptions succeeded, want exactly 1", succeeded)
+			}
+
+			total, _, err := svc.repo.CountUses(context.Background(), v.ID, "")
+			if err != nil {
+				t.Fatalf("count uses: %v", err)
+			}
+			if total != 1 {
+				t.Fatalf("CountUses total = %d, want 1", total)
+			}
+		})
+	}
+}
+
+// The per-customer limit only serializes redemptions of the same customer:
+// every other customer still gets their one use.
+func TestRedeemConcurrentPerCustomerLimitAllowsOtherCustomers(t *testing.T) {
+	svc, pool := newTestService(t)
+	one := 1
+	v := createLimitedVoucher(t, svc, pool, nil, &one)
+
+	customerID := func(i int) string { return fmt.Sprintf("customer-%d", i%2) }
+	succeeded := 0
+	for _, appErr := range redeemConcurrently(svc, v.VoucherCode, customerID) {
+		if appErr == nil {
+			succeeded++
+		} else if appErr.StatusCode != http.StatusUnprocessableEntity {
+			t.Errorf("redeem error = %d %q, want %d", appErr.StatusCode, appErr.Message, http.StatusUnprocessableEntity)
+		}
+	}
+	if succeeded != 2 {
+		t.Fatalf("%d redemptions succeeded, want one per customer (2)", succeeded)
+	}
+
+	for _, id := range []string{"customer-0", "customer-1"} {
+		_, byCustomer, err := svc.repo.CountUses(context.Background(), v.ID, id)
+		if err != nil {
+			t.Fatalf("count uses: %v", err)
+		}
+		if byCustomer != 1 {
+			t.Fatalf("CountUses for %s = %d, want 1", id, byCustomer)
+		}
+	}
+}
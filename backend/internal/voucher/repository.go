@@ -4,9 +4,13 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/mhakimsaputra17/discount-voucher-management/backend/internal/audit"
+	"github.com/mhakimsaputra17/discount-voucher-management/backend/internal/codes"
+	"github.com/mhakimsaputra17/discount-voucher-management/backend/internal/database"
 )
 
 const (
@@ -14,18 +18,118 @@ const (
 	defaultOrder  = "asc"
 )
 
+// voucherZoneExpr is the time zone a voucher's dates are in: its own, or the
+// business time zone set as the session TimeZone by database.Connect.
+const voucherZoneExpr = `COALESCE(timezone, current_setting('TimeZone'))`
+
+// A voucher is valid from 00:00 on valid_from until 24:00 on expiry_date, in
+// its time zone.
+const (
+	voucherStartsAtExpr  = `(valid_from::TIMESTAMP AT TIME ZONE ` + voucherZoneExpr + `)`
+	voucherExpiresAtExpr = `((expiry_date + 1)::TIMESTAMP AT TIME ZONE ` + voucherZoneExpr + `)`
+)
+
+// voucherStatusExpr derives a voucher's status from its validity window. It is
+// shared by the select list and the status filter so both always agree.
+const voucherStatusExpr = `CASE
+		WHEN NOW() < ` + voucherStartsAtExpr + ` THEN 'scheduled'
+		WHEN NOW() >= ` + voucherExpiresAtExpr + ` THEN 'expired'
+		ELSE 'active'
+	END`
+
+// voucherColumns is the select list shared by every query that returns a
+// Voucher; keep it in sync with scanVoucher.
+const voucherColumns = `id,
+		voucher_code,
+		discount_type,
+		COALESCE(discount_percent, 0) AS discount_percent,
+		COALESCE(discount_amount, 0) AS discount_amount,
+		currency,
+		min_order_amount,
+		max_discount_amount,
+		TO_CHAR(valid_from, 'YYYY-MM-DD') AS valid_from,
+		TO_CHAR(expiry_date, 'YYYY-MM-DD') AS expiry_date,
+		timezone,
+		TO_CHAR(` + voucherExpiresAtExpr + ` AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS"Z"') AS expires_at,
+		` + voucherStatusExpr + ` AS status,
+		state,
+		campaign_id,
+		ARRAY(
+			SELECT t.name
+			FROM voucher_tags vt
+			JOIN tags t ON t.id = vt.tag_id
+			WHERE vt.voucher_id = vouchers.id
+			ORDER BY t.name
+		) AS tags,
+		max_redemptions,
+		max_redemptions_per_customer,
+		stackable,
+		exclusivity_group,
+		personal_customer_id,
+		ARRAY(
+			SELECT customer_id FROM voucher_customers vc
+			WHERE vc.voucher_id = vouchers.id
+			ORDER BY customer_id
+		) AS allowed_customer_ids,
+		ARRAY(
+			SELECT email_hash FROM voucher_customer_emails ve
+			WHERE ve.voucher_id = vouchers.id
+			ORDER BY email_hash
+		) AS allowed_email_hashes,
+		ARRAY(
+			SELECT sku FROM voucher_skus s
+			WHERE s.voucher_id = vouchers.id AND NOT s.excluded
+			ORDER BY sku
+		) AS include_skus,
+		ARRAY(
+			SELECT sku FROM voucher_skus s
+			WHERE s.voucher_id = vouchers.id AND s.excluded
+			ORDER BY sku
+		) AS exclude_skus,
+		ARRAY(
+			SELECT category_id FROM voucher_categories c
+			WHERE c.voucher_id = vouchers.id AND NOT c.excluded
+			ORDER BY category_id
+		) AS include_categories,
+		ARRAY(
+			SELECT category_id FROM voucher_categories c
+			WHERE c.voucher_id = vouchers.id AND c.excluded
+			ORDER BY category_id
+		) AS exclude_categories,
+		(SELECT COUNT(*) FROM voucher_redemptions vr WHERE vr.voucher_id = vouchers.id) AS redemption_count,
+		version,
+		TO_CHAR(created_at AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS"Z"') AS created_at,
+		TO_CHAR(updated_at AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS"Z"') AS updated_at,
+		TO_CHAR(deleted_at AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS"Z"') AS deleted_at`
+
 var sortColumns = map[string]string{
+	"valid_from":       "valid_from",
 	"expiry_date":      "expiry_date",
+	"discount_type":    "discount_type",
 	"discount_percent": "discount_percent",
+	"discount_amount":  "discount_amount",
 }
 
 // Repository handles voucher database operations.
 type Repository struct {
-	db *pgxpool.Pool
+	pool *pgxpool.Pool
+	db   database.Querier
 }
 
 func NewRepository(db *pgxpool.Pool) *Repository {
-	return &Repository{db: db}
+	return &Repository{pool: db, db: db}
+}
+
+// WithTx runs fn with a repository bound to a single transaction, committing
+// when fn returns nil and rolling back otherwise. Calling WithTx on a
+// repository that is already transactional reuses the open transaction.
+func (r *Repository) WithTx(ctx context.Context, fn func(tx *Repository) error) error {
+	if _, ok := r.db.(pgx.Tx); ok {
+		return fn(r)
+	}
+	return pgx.BeginFunc(ctx, r.pool, func(tx pgx.Tx) error {
+		return fn(&Repository{pool: r.pool, db: tx})
+	})
 }
 
 func (r *Repository) List(ctx context.Context, params ListParams) ([]Voucher, int, error) {
@@ -41,7 +145,10 @@ func (r *Repository) List(ctx context.Context, params ListParams) ([]Voucher, in
 	}
 
 	args := []any{}
-	whereClauses := []string{"1=1"}
+	whereClauses := []string{"deleted_at IS NULL"}
+	if params.Trashed {
+		whereClauses = []string{"deleted_at IS NOT NULL"}
+	}
 
 	if params.Search != "" {
 		placeholder := len(args) + 1
@@ -49,21 +156,46 @@ func (r *Repository) List(ctx context.Context, params ListParams) ([]Voucher, in
 		args = append(args, fmt.Sprintf("%%%s%%", params.Search))
 	}
 
+	if params.Status != "" {
+		placeholder := len(args) + 1
+		whereClauses = append(whereClauses, fmt.Sprintf("(%s) = $%d", voucherStatusExpr, placeholder))
+		args = append(args, params.Status)
+	}
+
+	if params.State != "" {
+		placeholder := len(args) + 1
+		whereClauses = append(whereClauses, fmt.Sprintf("state = $%d", placeholder))
+		args = append(args, params.State)
+	}
+
+	if params.CampaignID != nil {
+		placeholder := len(args) + 1
+		whereClauses = append(whereClauses, fmt.Sprintf("campaign_id = $%d", placeholder))
+		args = append(args, *params.CampaignID)
+	}
+
+	// Every requested tag must be present on the voucher.
+	if len(params.Tags) > 0 {
+		placeholder := len(args) + 1
+		whereClauses = append(whereClauses, fmt.Sprintf(`(
+			SELECT COUNT(*)
+			FROM voucher_tags vt
+			JOIN tags t ON t.id = vt.tag_id
+			WHERE vt.voucher_id = vouchers.id AND t.name = ANY($%d::TEXT[])
+		) = CARDINALITY($%d::TEXT[])`, placeholder, placeholder))
+		args = append(args, params.Tags)
+	}
+
 	limitPlaceholder := len(args) + 1
 	offsetPlaceholder := limitPlaceholder + 1
 
 	query := fmt.Sprintf(`
-		SELECT id,
-		       voucher_code,
-		       discount_percent,
-		       TO_CHAR(expiry_date, 'YYYY-MM-DD') AS expiry_date,
-		       TO_CHAR(created_at AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS"Z"') AS created_at,
-		       TO_CHAR(updated_at AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS"Z"') AS updated_at
+		SELECT %s
 		FROM vouchers
 		WHERE %s
 		ORDER BY %s %s, id ASC
 		LIMIT $%d OFFSET $%d
-	`, strings.Join(whereClauses, " AND "), sortBy, order, limitPlaceholder, offsetPlaceholder)
+	`, voucherColumns, strings.Join(whereClauses, " AND "), sortBy, order, limitPlaceholder, offsetPlaceholder)
 
 	argsWithLimit := append(args, params.Limit, params.Offset)
 
@@ -75,8 +207,8 @@ func (r *Repository) List(ctx context.Context, params ListParams) ([]Voucher, in
 
 	var vouchers []Voucher
 	for rows.Next() {
-		var v Voucher
-		if err := rows.Scan(&v.ID, &v.VoucherCode, &v.DiscountPercent, &v.ExpiryDate, &v.CreatedAt, &v.UpdatedAt); err != nil {
+		v, err := scanVoucher(rows)
+		if err != nil {
 			return nil, 0, err
 		}
 		vouchers = append(vouchers, v)
@@ -101,62 +233,584 @@ func (r *Repository) List(ctx context.Context, params ListParams) ([]Voucher, in
 }
 
 func (r *Repository) GetByID(ctx context.Context, id int64) (Voucher, error) {
-	var v Voucher
-	err := r.db.QueryRow(ctx, `
-		SELECT id,
-		       voucher_code,
-		       discount_percent,
-		       TO_CHAR(expiry_date, 'YYYY-MM-DD') AS expiry_date,
-		       TO_CHAR(created_at AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS"Z"') AS created_at,
-		       TO_CHAR(updated_at AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS"Z"') AS updated_at
+	return scanVoucher(r.db.QueryRow(ctx, `
+		SELECT `+voucherColumns+`
 		FROM vouchers
-		WHERE id = $1
-	`, id).Scan(&v.ID, &v.VoucherCode, &v.DiscountPercent, &v.ExpiryDate, &v.CreatedAt, &v.UpdatedAt)
-	if err != nil {
-		if err == pgx.ErrNoRows {
-			return Voucher{}, err
-		}
-		return Voucher{}, err
-	}
-	return v, nil
+		WHERE id = $1 AND deleted_at IS NULL
+	`, id))
+}
+
+// GetByIDForUpdate is GetByID with a row lock held until the surrounding
+// transaction ends.
+func (r *Repository) GetByIDForUpdate(ctx context.Context, id int64) (Voucher, error) {
+	return scanVoucher(r.db.QueryRow(ctx, `
+		SELECT `+voucherColumns+`
+		FROM vouchers
+		WHERE id = $1 AND deleted_at IS NULL
+		FOR UPDATE
+	`, id))
+}
+
+// GetDeletedByIDForUpdate loads a voucher from the trash and locks its row
+// until the surrounding transaction ends.
+func (r *Repository) GetDeletedByIDForUpdate(ctx context.Context, id int64) (Voucher, error) {
+	return scanVoucher(r.db.QueryRow(ctx, `
+		SELECT `+voucherColumns+`
+		FROM vouchers
+		WHERE id = $1 AND deleted_at IS NOT NULL
+		FOR UPDATE
+	`, id))
+}
+
+// GetByCodeForUpdate loads a voucher by code and locks its row until the
+// surrounding transaction ends. It must be called on a repository returned by
+// WithTx.
+func (r *Repository) GetByCodeForUpdate(ctx context.Context, code string) (Voucher, error) {
+	return scanVoucher(r.db.QueryRow(ctx, `
+		SELECT `+voucherColumns+`
+		FROM vouchers
+		WHERE UPPER(voucher_code) = UPPER($1) AND deleted_at IS NULL
+		FOR UPDATE
+	`, code))
+}
+
+// GetByCode returns the live voucher with the given code, compared
+// case-insensitively.
+func (r *Repository) GetByCode(ctx context.Context, code string) (Voucher, error) {
+	return scanVoucher(r.db.QueryRow(ctx, `
+		SELECT `+voucherColumns+`
+		FROM vouchers
+		WHERE UPPER(voucher_code) = UPPER($1) AND deleted_at IS NULL
+	`, code))
 }
 
+// Create inserts a voucher together with its tags.
 func (r *Repository) Create(ctx context.Context, v Voucher) (Voucher, error) {
 	var created Voucher
-	err := r.db.QueryRow(ctx, `
-		INSERT INTO vouchers (voucher_code, discount_percent, expiry_date)
-		VALUES ($1, $2, $3)
-		RETURNING id,
-		          voucher_code,
-		          discount_percent,
-		          TO_CHAR(expiry_date, 'YYYY-MM-DD') AS expiry_date,
-		          TO_CHAR(created_at AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS"Z"') AS created_at,
-		          TO_CHAR(updated_at AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS"Z"') AS updated_at
-	`, v.VoucherCode, v.DiscountPercent, v.ExpiryDate).Scan(&created.ID, &created.VoucherCode, &created.DiscountPercent, &created.ExpiryDate, &created.CreatedAt, &created.UpdatedAt)
+	err := r.WithTx(ctx, func(tx *Repository) error {
+		var err error
+		created, err = tx.insert(ctx, v)
+		if err != nil {
+			return err
+		}
+		if len(v.Tags) > 0 {
+			if err := tx.setTags(ctx, created.ID, v.Tags); err != nil {
+				return err
+			}
+			created.Tags = v.Tags
+		}
+		if err := tx.setScopes(ctx, []int64{created.ID}, v); err != nil {
+			return err
+		}
+		created.copyScopes(v)
+		if err := tx.setAllowlists(ctx, []int64{created.ID}, v); err != nil {
+			return err
+		}
+		created.copyAllowlists(v)
+		return nil
+	})
 	return created, err
 }
 
-func (r *Repository) Update(ctx context.Context, id int64, v Voucher) (Voucher, error) {
+func (r *Repository) insert(ctx context.Context, v Voucher) (Voucher, error) {
+	return scanVoucher(r.db.QueryRow(ctx, `
+		INSERT INTO vouchers (
+			voucher_code,
+			discount_type,
+			discount_percent,
+			discount_amount,
+			currency,
+			min_order_amount,
+			max_discount_amount,
+			valid_from,
+			expiry_date,
+			state,
+			campaign_id,
+			max_redemptions,
+			max_redemptions_per_customer,
+			stackable,
+			exclusivity_group,
+			personal_customer_id,
+			timezone
+		)
+		VALUES (
+			$1, $2, NULLIF($3, 0), NULLIF($4::BIGINT, 0), $5, $6, $7,
+			COALESCE(NULLIF($8, '')::DATE, (NOW() AT TIME ZONE COALESCE($17::TEXT, current_setting('TimeZone')))::DATE),
+			$9, $10, $11, $12, $13, $14, $15, $16, $17
+		)
+		RETURNING `+voucherColumns,
+		v.VoucherCode,
+		v.DiscountType,
+		v.DiscountPercent,
+		v.DiscountAmount,
+		v.Currency,
+		v.MinOrderAmount,
+		v.MaxDiscountAmount,
+		v.ValidFrom,
+		v.ExpiryDate,
+		v.State,
+		v.CampaignID,
+		v.MaxRedemptions,
+		v.MaxRedemptionsPerCustomer,
+		v.Stackable,
+		v.ExclusivityGroup,
+		v.PersonalCustomerID,
+		v.Timezone,
+	))
+}
+
+// Update replaces a voucher's attributes, keeping the previous version as a
+// snapshot. Its tags and each scope list are replaced as well unless nil, in
+// which case they are left untouched. A non-nil versions
+// restricts the update to those versions; pgx.ErrNoRows is returned when the
+// voucher does not exist or its version does not match.
+func (r *Repository) Update(ctx context.Context, id int64, v Voucher, versions []int) (Voucher, error) {
 	var updated Voucher
-	err := r.db.QueryRow(ctx, `
+	err := r.WithTx(ctx, func(tx *Repository) error {
+		if err := tx.snapshot(ctx, id); err != nil {
+			return err
+		}
+		var err error
+		updated, err = tx.update(ctx, id, v, versions)
+		if err != nil {
+			return err
+		}
+		if v.Tags != nil {
+			if err := tx.setTags(ctx, id, v.Tags); err != nil {
+				return err
+			}
+			updated.Tags = v.Tags
+		}
+		if err := tx.setScopes(ctx, []int64{id}, v); err != nil {
+			return err
+		}
+		updated.copyScopes(v)
+		if err := tx.setAllowlists(ctx, []int64{id}, v); err != nil {
+			return err
+		}
+		updated.copyAllowlists(v)
+		return nil
+	})
+	return updated, err
+}
+
+func (r *Repository) update(ctx context.Context, id int64, v Voucher, versions []int) (Voucher, error) {
+	return scanVoucher(r.db.QueryRow(ctx, `
 		UPDATE vouchers
 		SET voucher_code = $1,
-			discount_percent = $2,
-			expiry_date = $3,
+			discount_type = $2,
+			discount_percent = NULLIF($3, 0),
+			discount_amount = NULLIF($4::BIGINT, 0),
+			currency = $5,
+			min_order_amount = $6,
+			max_discount_amount = $7,
+			valid_from = COALESCE(NULLIF($8, '')::DATE, valid_from),
+			expiry_date = $9,
+			campaign_id = $10,
+			max_redemptions = $11,
+			max_redemptions_per_customer = $12,
+			stackable = $13,
+			exclusivity_group = $14,
+			personal_customer_id = $15,
+			timezone = $16,
 			updated_at = NOW()
-		WHERE id = $4
-		RETURNING id,
-		          voucher_code,
-		          discount_percent,
-		          TO_CHAR(expiry_date, 'YYYY-MM-DD') AS expiry_date,
-		          TO_CHAR(created_at AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS"Z"') AS created_at,
-		          TO_CHAR(updated_at AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS"Z"') AS updated_at
-	`, v.VoucherCode, v.DiscountPercent, v.ExpiryDate, id).Scan(&updated.ID, &updated.VoucherCode, &updated.DiscountPercent, &updated.ExpiryDate, &updated.CreatedAt, &updated.UpdatedAt)
+		WHERE id = $17 AND deleted_at IS NULL AND ($18::INTEGER[] IS NULL OR version = ANY($18::INTEGER[]))
+		RETURNING `+voucherColumns,
+		v.VoucherCode,
+		v.DiscountType,
+		v.DiscountPercent,
+		v.DiscountAmount,
+		v.Currency,
+		v.MinOrderAmount,
+		v.MaxDiscountAmount,
+		v.ValidFrom,
+		v.ExpiryDate,
+		v.CampaignID,
+		v.MaxRedemptions,
+		v.MaxRedemptionsPerCustomer,
+		v.Stackable,
+		v.ExclusivityGroup,
+		v.PersonalCustomerID,
+		v.Timezone,
+		id,
+		versions,
+	))
+}
+
+// CreateBatch inserts one voucher per code, all sharing the attributes of
+// template. Codes that collide with an existing live voucher are skipped;
+// the vouchers that were actually inserted are returned.
+func (r *Repository) CreateBatch(ctx context.Context, template Voucher, voucherCodes []string) ([]Voucher, error) {
+	var inserted []Voucher
+	err := r.WithTx(ctx, func(tx *Repository) error {
+		rows, err := tx.db.Query(ctx, `
+			INSERT INTO vouchers (
+				voucher_code,
+				discount_type,
+				discount_percent,
+				discount_amount,
+				currency,
+				min_order_amount,
+				max_discount_amount,
+				valid_from,
+				expiry_date,
+				state,
+				campaign_id,
+				max_redemptions,
+				max_redemptions_per_customer,
+				stackable,
+				exclusivity_group,
+				personal_customer_id,
+				timezone
+			)
+			SELECT
+				code, $2::TEXT, NULLIF($3::INTEGER, 0), NULLIF($4::BIGINT, 0), $5::TEXT, $6::BIGINT, $7::BIGINT,
+				COALESCE(NULLIF($8::TEXT, '')::DATE, (NOW() AT TIME ZONE COALESCE($17::TEXT, current_setting('TimeZone')))::DATE),
+				$9::DATE, $10::TEXT, $11::BIGINT, $12::INTEGER, $13::INTEGER,
+				$14::BOOLEAN, $15::TEXT, $16::TEXT, $17::TEXT
+			FROM UNNEST($1::TEXT[]) AS code
+			ON CONFLICT DO NOTHING
+			RETURNING `+voucherColumns,
+			voucherCodes,
+			template.DiscountType,
+			template.DiscountPercent,
+			template.DiscountAmount,
+			template.Currency,
+			template.MinOrderAmount,
+			template.MaxDiscountAmount,
+			template.ValidFrom,
+			template.ExpiryDate,
+			template.State,
+			template.CampaignID,
+			template.MaxRedemptions,
+			template.MaxRedemptionsPerCustomer,
+			template.Stackable,
+			template.ExclusivityGroup,
+			template.PersonalCustomerID,
+			template.Timezone,
+		)
+		if err != nil {
+			return err
+		}
+
+		ids := make([]int64, 0, len(voucherCodes))
+		inserted = make([]Voucher, 0, len(voucherCodes))
+		for rows.Next() {
+			v, err := scanVoucher(rows)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			v.Tags = template.Tags
+			v.copyScopes(template)
+			v.copyAllowlists(template)
+			ids = append(ids, v.ID)
+			inserted = append(inserted, v)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		if len(ids) == 0 {
+			return nil
+		}
+		if err := tx.setScopes(ctx, ids, template); err != nil {
+			return err
+		}
+		if err := tx.setAllowlists(ctx, ids, template); err != nil {
+			return err
+		}
+		if len(template.Tags) == 0 {
+			return nil
+		}
+		if _, err := tx.db.Exec(ctx, `
+			INSERT INTO tags (name)
+			SELECT UNNEST($1::TEXT[])
+			ON CONFLICT (name) DO NOTHING
+		`, template.Tags); err != nil {
+			return err
+		}
+		_, err = tx.db.Exec(ctx, `
+			INSERT INTO voucher_tags (voucher_id, tag_id)
+			SELECT v.id, t.id
+			FROM UNNEST($1::BIGINT[]) AS v(id)
+			CROSS JOIN tags t
+			WHERE t.name = ANY($2::TEXT[])
+		`, ids, template.Tags)
+		return err
+	})
+	return inserted, err
+}
+
+// RecordAudit appends entries to the audit log. Call it on a repository
+// returned by WithTx so the entries commit together with the change.
+func (r *Repository) RecordAudit(ctx context.Context, entries ...audit.Entry) error {
+	return audit.Insert(ctx, r.db, entries...)
+}
+
+// ListCheckDigitFormats returns every registered check-digit code format.
+func (r *Repository) ListCheckDigitFormats(ctx context.Context) ([]codes.Format, error) {
+	rows, err := r.db.Query(ctx, `SELECT prefix, charset FROM check_digit_prefixes`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var formats []codes.Format
+	for rows.Next() {
+		var f codes.Format
+		if err := rows.Scan(&f.Prefix, &f.Charset); err != nil {
+			return nil, err
+		}
+		formats = append(formats, f)
+	}
+
+	return formats, rows.Err()
+}
+
+// RegisterCheckDigitFormat records that codes starting with f.Prefix carry a
+// check character. If the prefix is already registered the existing format
+// is returned unchanged, so callers can detect a charset mismatch.
+func (r *Repository) RegisterCheckDigitFormat(ctx context.Context, f codes.Format) (codes.Format, error) {
+	var registered codes.Format
+	err := r.db.QueryRow(ctx, `
+		INSERT INTO check_digit_prefixes (prefix, charset)
+		VALUES ($1, $2)
+		ON CONFLICT (prefix) DO UPDATE SET prefix = EXCLUDED.prefix
+		RETURNING prefix, charset
+	`, f.Prefix, f.Charset).Scan(&registered.Prefix, &registered.Charset)
+	return registered, err
+}
+
+// setTags replaces the tags attached to a voucher, creating tag rows as
+// needed. Tags must already be normalized.
+func (r *Repository) setTags(ctx context.Context, voucherID int64, tags []string) error {
+	if _, err := r.db.Exec(ctx, `DELETE FROM voucher_tags WHERE voucher_id = $1`, voucherID); err != nil {
+		return err
+	}
+	if len(tags) == 0 {
+		return nil
+	}
+
+	if _, err := r.db.Exec(ctx, `
+		INSERT INTO tags (name)
+		SELECT UNNEST($1::TEXT[])
+		ON CONFLICT (name) DO NOTHING
+	`, tags); err != nil {
+		return err
+	}
+
+	_, err := r.db.Exec(ctx, `
+		INSERT INTO voucher_tags (voucher_id, tag_id)
+		SELECT $1, id FROM tags WHERE name = ANY($2::TEXT[])
+	`, voucherID, tags)
+	return err
+}
+
+// setScopes replaces, for every voucher in voucherIDs, each scope list that
+// is not nil in v. The lists must already be normalized.
+func (r *Repository) setScopes(ctx context.Context, voucherIDs []int64, v Voucher) error {
+	for _, list := range scopeLists {
+		values := *list.values(&v)
+		if values == nil {
+			continue
+		}
+		if _, err := r.db.Exec(ctx, fmt.Sprintf(`
+			DELETE FROM %s WHERE voucher_id = ANY($1::BIGINT[]) AND excluded = $2
+		`, list.table), voucherIDs, list.excluded); err != nil {
+			return err
+		}
+		if len(values) == 0 {
+			continue
+		}
+		if _, err := r.db.Exec(ctx, fmt.Sprintf(`
+			INSERT INTO %s (voucher_id, %s, excluded)
+			SELECT id, value, $3
+			FROM UNNEST($1::BIGINT[]) AS id
+			CROSS JOIN UNNEST($2::TEXT[]) AS value
+		`, list.table, list.column), voucherIDs, values, list.excluded); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setAllowlists replaces, for every voucher in voucherIDs, each allowlist
+// that is not nil in v. The lists must already be normalized.
+func (r *Repository) setAllowlists(ctx context.Context, voucherIDs []int64, v Voucher) error {
+	for _, list := range allowlists {
+		values := *list.values(&v)
+		if values == nil {
+			continue
+		}
+		if _, err := r.db.Exec(ctx, fmt.Sprintf(`
+			DELETE FROM %s WHERE voucher_id = ANY($1::BIGINT[])
+		`, list.table), voucherIDs); err != nil {
+			return err
+		}
+		if len(values) == 0 {
+			continue
+		}
+		if _, err := r.db.Exec(ctx, fmt.Sprintf(`
+			INSERT INTO %s (voucher_id, %s)
+			SELECT id, value
+			FROM UNNEST($1::BIGINT[]) AS id
+			CROSS JOIN UNNEST($2::TEXT[]) AS value
+		`, list.table, list.column), voucherIDs, values); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListTags returns every tag with the number of live vouchers using it.
+func (r *Repository) ListTags(ctx context.Context) ([]Tag, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT t.name, COUNT(v.id) AS usage_count
+		FROM tags t
+		LEFT JOIN voucher_tags vt ON vt.tag_id = t.id
+		LEFT JOIN vouchers v ON v.id = vt.voucher_id AND v.deleted_at IS NULL
+		GROUP BY t.name
+		ORDER BY usage_count DESC, t.name ASC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := make([]Tag, 0)
+	for rows.Next() {
+		var t Tag
+		if err := rows.Scan(&t.Name, &t.UsageCount); err != nil {
+			return nil, err
+		}
+		tags = append(tags, t)
+	}
+
+	return tags, rows.Err()
+}
+
+// UpdateState changes a voucher's lifecycle state, keeping the previous
+// version as a snapshot.
+func (r *Repository) UpdateState(ctx context.Context, id int64, state string) (Voucher, error) {
+	var updated Voucher
+	err := r.WithTx(ctx, func(tx *Repository) error {
+		if err := tx.snapshot(ctx, id); err != nil {
+			return err
+		}
+		var err error
+		updated, err = scanVoucher(tx.db.QueryRow(ctx, `
+			UPDATE vouchers
+			SET state = $1,
+				updated_at = NOW()
+			WHERE id = $2 AND deleted_at IS NULL
+			RETURNING `+voucherColumns,
+			state, id))
+		return err
+	})
 	return updated, err
 }
 
-func (r *Repository) Delete(ctx context.Context, id int64) error {
-	cmdTag, err := r.db.Exec(ctx, `DELETE FROM vouchers WHERE id = $1`, id)
+// snapshot stores the current version of a voucher, live or in the trash,
+// in voucher_versions. Every update bumps the version, so every write path
+// calls it first. The snapshot has the same shape as the API representation
+// of a voucher.
+func (r *Repository) snapshot(ctx context.Context, id int64) error {
+	_, err := r.db.Exec(ctx, `
+		INSERT INTO voucher_versions (voucher_id, version, snapshot)
+		SELECT v.id, v.version, TO_JSONB(v)
+		FROM (
+			SELECT `+voucherColumns+`
+			FROM vouchers
+			WHERE id = $1
+		) v
+		ON CONFLICT (voucher_id, version) DO NOTHING
+	`, id)
+	return err
+}
+
+// ListVersions returns the stored prior versions of a voucher, newest first.
+func (r *Repository) ListVersions(ctx context.Context, id int64) ([]VoucherVersion, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT version, snapshot, TO_CHAR(replaced_at AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS"Z"')
+		FROM voucher_versions
+		WHERE voucher_id = $1
+		ORDER BY version DESC
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var versions []VoucherVersion
+	for rows.Next() {
+		var vv VoucherVersion
+		if err := rows.Scan(&vv.Version, &vv.Voucher, &vv.ReplacedAt); err != nil {
+			return nil, err
+		}
+		versions = append(versions, vv)
+	}
+
+	return versions, rows.Err()
+}
+
+// GetVersion returns one stored prior version of a voucher.
+func (r *Repository) GetVersion(ctx context.Context, id int64, version int) (VoucherVersion, error) {
+	var vv VoucherVersion
+	err := r.db.QueryRow(ctx, `
+		SELECT version, snapshot, TO_CHAR(replaced_at AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS"Z"')
+		FROM voucher_versions
+		WHERE voucher_id = $1 AND version = $2
+	`, id, version).Scan(&vv.Version, &vv.Voucher, &vv.ReplacedAt)
+	return vv, err
+}
+
+// Delete moves a voucher to the trash and returns it, keeping the previous
+// version as a snapshot. The row is kept so it can be restored; use Purge to
+// remove it permanently.
+func (r *Repository) Delete(ctx context.Context, id int64, versions []int) (Voucher, error) {
+	var deleted Voucher
+	err := r.WithTx(ctx, func(tx *Repository) error {
+		if err := tx.snapshot(ctx, id); err != nil {
+			return err
+		}
+		var err error
+		deleted, err = scanVoucher(tx.db.QueryRow(ctx, `
+			UPDATE vouchers
+			SET deleted_at = NOW()
+			WHERE id = $1 AND deleted_at IS NULL AND ($2::INTEGER[] IS NULL OR version = ANY($2::INTEGER[]))
+			RETURNING `+voucherColumns,
+			id, versions))
+		return err
+	})
+	return deleted, err
+}
+
+// Restore takes a voucher out of the trash, keeping the previous version as a
+// snapshot.
+func (r *Repository) Restore(ctx context.Context, id int64) (Voucher, error) {
+	var restored Voucher
+	err := r.WithTx(ctx, func(tx *Repository) error {
+		if err := tx.snapshot(ctx, id); err != nil {
+			return err
+		}
+		var err error
+		restored, err = scanVoucher(tx.db.QueryRow(ctx, `
+			UPDATE vouchers
+			SET deleted_at = NULL,
+				updated_at = NOW()
+			WHERE id = $1 AND deleted_at IS NOT NULL
+			RETURNING `+voucherColumns,
+			id))
+		return err
+	})
+	return restored, err
+}
+
+// Purge permanently deletes a voucher that is already in the trash.
+func (r *Repository) Purge(ctx context.Context, id int64) error {
+	cmdTag, err := r.db.Exec(ctx, `DELETE FROM vouchers WHERE id = $1 AND deleted_at IS NOT NULL`, id)
 	if err != nil {
 		return err
 	}
@@ -167,7 +821,7 @@ func (r *Repository) Delete(ctx context.Context, id int64) error {
 }
 
 func (r *Repository) ExistsByCode(ctx context.Context, code string, excludeID *int64) (bool, error) {
-	query := `SELECT 1 FROM vouchers WHERE voucher_code = $1`
+	query := `SELECT 1 FROM vouchers WHERE UPPER(voucher_code) = UPPER($1) AND deleted_at IS NULL`
 	args := []any{code}
 
 	if excludeID != nil {
@@ -188,13 +842,9 @@ func (r *Repository) ExistsByCode(ctx context.Context, code string, excludeID *i
 
 func (r *Repository) GetAll(ctx context.Context) ([]Voucher, error) {
 	rows, err := r.db.Query(ctx, `
-		SELECT id,
-		       voucher_code,
-		       discount_percent,
-		       TO_CHAR(expiry_date, 'YYYY-MM-DD') AS expiry_date,
-		       TO_CHAR(created_at AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS"Z"') AS created_at,
-		       TO_CHAR(updated_at AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS"Z"') AS updated_at
+		SELECT `+voucherColumns+`
 		FROM vouchers
+		WHERE deleted_at IS NULL
 		ORDER BY id ASC
 	`)
 	if err != nil {
@@ -204,8 +854,8 @@ func (r *Repository) GetAll(ctx context.Context) ([]Voucher, error) {
 
 	var vouchers []Voucher
 	for rows.Next() {
-		var v Voucher
-		if err := rows.Scan(&v.ID, &v.VoucherCode, &v.DiscountPercent, &v.ExpiryDate, &v.CreatedAt, &v.UpdatedAt); err != nil {
+		v, err := scanVoucher(rows)
+		if err != nil {
 			return nil, err
 		}
 		vouchers = append(vouchers, v)
@@ -217,3 +867,225 @@ func (r *Repository) GetAll(ctx context.Context) ([]Voucher, error) {
 
 	return vouchers, nil
 }
+
+func (r *Repository) CreateRedemption(ctx context.Context, redemption Redemption) (Redemption, error) {
+	created := redemption
+	err := r.db.QueryRow(ctx, `
+		INSERT INTO voucher_redemptions (voucher_id, customer_id, order_reference, order_amount, discount_amount)
+		VALUES ($1, NULLIF($2, ''), $3, $4, $5)
+		RETURNING id,
+		          TO_CHAR(redeemed_at AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS"Z"') AS redeemed_at
+	`, redemption.VoucherID, redemption.CustomerID, redemption.OrderReference, redemption.OrderAmount, redemption.DiscountAmount).Scan(&created.ID, &created.RedeemedAt)
+	return created, err
+}
+
+// LockOrder takes a lock on an order reference that is held until the
+// surrounding transaction ends, so vouchers are added to an order one at a
+// time.
+func (r *Repository) LockOrder(ctx context.Context, orderReference string) error {
+	_, err := r.db.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtextextended($1, 0))`, orderReference)
+	return err
+}
+
+// ListOrderVouchers returns the vouchers other than excludeID that have been
+// redeemed on an order or are held for it by an unexpired reservation.
+func (r *Repository) ListOrderVouchers(ctx context.Context, orderReference string, excludeID int64) ([]Voucher, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT `+voucherColumns+`
+		FROM vouchers
+		WHERE id <> $2 AND id IN (
+			SELECT voucher_id FROM voucher_redemptions WHERE order_reference = $1
+			UNION
+			SELECT voucher_id FROM voucher_reservations
+			WHERE order_reference = $1 AND status = 'held' AND expires_at > NOW()
+		)
+		ORDER BY id
+	`, orderReference, excludeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var vouchers []Voucher
+	for rows.Next() {
+		v, err := scanVoucher(rows)
+		if err != nil {
+			return nil, err
+		}
+		vouchers = append(vouchers, v)
+	}
+
+	return vouchers, rows.Err()
+}
+
+// CountUses returns how many uses of a voucher are taken in total and by the
+// given customer: redemptions plus reservations that are still held. Callers
+// enforcing limits must hold the voucher row lock (see GetByCodeForUpdate) so
+// the counts cannot change underneath them.
+func (r *Repository) CountUses(ctx context.Context, voucherID int64, customerID string) (total int, byCustomer int, err error) {
+	err = r.db.QueryRow(ctx, `
+		SELECT COUNT(*),
+		       COUNT(*) FILTER (WHERE customer_id = $2)
+		FROM (
+			SELECT customer_id
+			FROM voucher_redemptions
+			WHERE voucher_id = $1
+			UNION ALL
+			SELECT customer_id
+			FROM voucher_reservations
+			WHERE voucher_id = $1 AND status = 'held' AND expires_at > NOW()
+		) uses
+	`, voucherID, customerID).Scan(&total, &byCustomer)
+	return total, byCustomer, err
+}
+
+// reservationColumns is the select list for queries returning a Reservation
+// from voucher_reservations r joined with vouchers v; keep it in sync with
+// scanReservation.
+const reservationColumns = `r.id,
+		r.voucher_id,
+		v.voucher_code,
+		COALESCE(r.customer_id, ''),
+		r.order_reference,
+		r.order_amount,
+		r.discount_amount,
+		CASE WHEN r.status = 'held' AND r.expires_at <= NOW() THEN 'expired' ELSE r.status END AS status,
+		TO_CHAR(r.expires_at AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS"Z"') AS expires_at,
+		r.redemption_id,
+		TO_CHAR(r.created_at AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS"Z"') AS created_at,
+		TO_CHAR(r.updated_at AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS"Z"') AS updated_at`
+
+// CreateReservation holds a use of the voucher for the order. A lapsed hold
+// for the same voucher and order that the sweeper has not expired yet is
+// expired first so it does not block the new one; call it on a repository
+// returned by WithTx so both happen together.
+func (r *Repository) CreateReservation(ctx context.Context, res Reservation, ttl time.Duration) (Reservation, error) {
+	if _, err := r.db.Exec(ctx, `
+		UPDATE voucher_reservations
+		SET status = 'expired',
+			updated_at = NOW()
+		WHERE voucher_id = $1 AND order_reference = $2 AND status = 'held' AND expires_at <= NOW()
+	`, res.VoucherID, res.OrderReference); err != nil {
+		return Reservation{}, err
+	}
+
+	return scanReservation(r.db.QueryRow(ctx, `
+		WITH r AS (
+			INSERT INTO voucher_reservations (voucher_id, customer_id, order_reference, order_amount, discount_amount, expires_at)
+			VALUES ($1, NULLIF($2, ''), $3, $4, $5, NOW() + $6::BIGINT * INTERVAL '1 second')
+			RETURNING *
+		)
+		SELECT `+reservationColumns+`
+		FROM r
+		JOIN vouchers v ON v.id = r.voucher_id
+	`, res.VoucherID, res.CustomerID, res.OrderReference, res.OrderAmount, res.DiscountAmount, int64(ttl/time.Second)))
+}
+
+func (r *Repository) GetReservation(ctx context.Context, id int64) (Reservation, error) {
+	return scanReservation(r.db.QueryRow(ctx, `
+		SELECT `+reservationColumns+`
+		FROM voucher_reservations r
+		JOIN vouchers v ON v.id = r.voucher_id
+		WHERE r.id = $1
+	`, id))
+}
+
+func (r *Repository) GetReservationForUpdate(ctx context.Context, id int64) (Reservation, error) {
+	return scanReservation(r.db.QueryRow(ctx, `
+		SELECT `+reservationColumns+`
+		FROM voucher_reservations r
+		JOIN vouchers v ON v.id = r.voucher_id
+		WHERE r.id = $1
+		FOR UPDATE OF r
+	`, id))
+}
+
+func (r *Repository) UpdateReservationStatus(ctx context.Context, id int64, status string, redemptionID *int64) (Reservation, error) {
+	return scanReservation(r.db.QueryRow(ctx, `
+		WITH r AS (
+			UPDATE voucher_reservations
+			SET status = $2,
+				redemption_id = $3,
+				updated_at = NOW()
+			WHERE id = $1
+			RETURNING *
+		)
+		SELECT `+reservationColumns+`
+		FROM r
+		JOIN vouchers v ON v.id = r.voucher_id
+	`, id, status, redemptionID))
+}
+
+// ExpireReservations marks held reservations past their expiry as expired
+// and returns how many were updated.
+func (r *Repository) ExpireReservations(ctx context.Context) (int64, error) {
+	cmdTag, err := r.db.Exec(ctx, `
+		UPDATE voucher_reservations
+		SET status = 'expired',
+			updated_at = NOW()
+		WHERE status = 'held' AND expires_at <= NOW()
+	`)
+	if err != nil {
+		return 0, err
+	}
+	return cmdTag.RowsAffected(), nil
+}
+
+func scanVoucher(row pgx.Row) (Voucher, error) {
+	var v Voucher
+	err := row.Scan(
+		&v.ID,
+		&v.VoucherCode,
+		&v.DiscountType,
+		&v.DiscountPercent,
+		&v.DiscountAmount,
+		&v.Currency,
+		&v.MinOrderAmount,
+		&v.MaxDiscountAmount,
+		&v.ValidFrom,
+		&v.ExpiryDate,
+		&v.Timezone,
+		&v.ExpiresAt,
+		&v.Status,
+		&v.State,
+		&v.CampaignID,
+		&v.Tags,
+		&v.MaxRedemptions,
+		&v.MaxRedemptionsPerCustomer,
+		&v.Stackable,
+		&v.ExclusivityGroup,
+		&v.PersonalCustomerID,
+		&v.AllowedCustomerIDs,
+		&v.AllowedEmailHashes,
+		&v.IncludeSKUs,
+		&v.ExcludeSKUs,
+		&v.IncludeCategories,
+		&v.ExcludeCategories,
+		&v.RedemptionCount,
+		&v.Version,
+		&v.CreatedAt,
+		&v.UpdatedAt,
+		&v.DeletedAt,
+	)
+	return v, err
+}
+
+func scanReservation(row pgx.Row) (Reservation, error) {
+	var res Reservation
+	err := row.Scan(
+		&res.ID,
+		&res.VoucherID,
+		&res.VoucherCode,
+		&res.CustomerID,
+		&res.OrderReference,
+		&res.OrderAmount,
+		&res.DiscountAmount,
+		&res.Status,
+		&res.ExpiresAt,
+		&res.RedemptionID,
+		&res.CreatedAt,
+		&res.UpdatedAt,
+	)
+	res.FinalAmount = res.OrderAmount - res.DiscountAmount
+	return res, err
+}
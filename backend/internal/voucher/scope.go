@@ -0,0 +1,316 @@
+package voucher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/mhakimsaputra17/discount-voucher-management/backend/internal/common"
+)
+
+// scopeList is one of the include/exclude lists restricting a voucher to
+// some products, and where it is stored.
+type scopeList struct {
+	field    string
+	table    string
+	column   string
+	excluded bool
+	values   func(v *Voucher) *[]string
+}
+
+var scopeLists = []scopeList{
+	{"include_skus", "voucher_skus", "sku", false, func(v *Voucher) *[]string { return &v.IncludeSKUs }},
+	{"exclude_skus", "voucher_skus", "sku", true, func(v *Voucher) *[]string { return &v.ExcludeSKUs }},
+	{"include_categories", "voucher_categories", "category_id", false, func(v *Voucher) *[]string { return &v.IncludeCategories }},
+	{"exclude_categories", "voucher_categories", "category_id", true, func(v *Voucher) *[]string { return &v.ExcludeCategories }},
+}
+
+// CartLine is one line of an order. CategoryID is optional; a line without
+// one only matches SKU rules.
+type CartLine struct {
+	SKU        string `json:"sku" binding:"required"`
+	CategoryID string `json:"category_id"`
+	Quantity   int64  `json:"quantity" binding:"required,min=1,max=1000000"`
+	UnitPrice  int64  `json:"unit_price" binding:"min=0,max=1000000000000000"`
+}
+
+// total returns the line total; ok is false when it does not fit in an
+// int64.
+func (l CartLine) total() (total int64, ok bool) {
+	if l.Quantity < 0 || l.UnitPrice < 0 {
+		return 0, false
+	}
+	if l.UnitPrice != 0 && l.Quantity > math.MaxInt64/l.UnitPrice {
+		return 0, false
+	}
+	return l.Quantity * l.UnitPrice, true
+}
+
+// addTotal adds a line total to a running cart total, rejecting a sum that
+// does not fit in an int64.
+func addTotal(sum, lineTotal int64) (int64, *common.AppError) {
+	if lineTotal > math.MaxInt64-sum {
+		return 0, common.NewValidationError("the cart total is too large", nil)
+	}
+	return sum + lineTotal, nil
+}
+
+type CalculateDiscountInput struct {
+	VoucherCode   string     `json:"voucher_code" binding:"required"`
+	CustomerID    string     `json:"customer_id"`
+	CustomerEmail string     `json:"customer_email" binding:"omitempty,email"`
+	Currency      string     `json:"currency" binding:"omitempty,len=3"`
+	Lines         []CartLine `json:"lines" binding:"required,min=1,max=500,dive"`
+}
+
+// LineDiscount is a cart line with the share of the discount it receives.
+type LineDiscount struct {
+	CartLine
+	LineTotal      int64 `json:"line_total"`
+	Eligible       bool  `json:"eligible"`
+	DiscountAmount int64 `json:"discount_amount"`
+}
+
+// Calculation is the discount a voucher grants on a cart. The voucher
+// minimum order amount is compared with EligibleSubtotal.
+type Calculation struct {
+	VoucherCode      string         `json:"voucher_code"`
+	Subtotal         int64          `json:"subtotal"`
+	EligibleSubtotal int64          `json:"eligible_subtotal"`
+	DiscountAmount   int64          `json:"discount_amount"`
+	FinalAmount      int64          `json:"final_amount"`
+	Lines            []LineDiscount `json:"lines"`
+}
+
+// scoped reports whether v is restricted to some products.
+func (v Voucher) scoped() bool {
+	for _, list := range scopeLists {
+		if len(*list.values(&v)) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// appliesTo reports whether line is eligible for v. A line is eligible when
+// no include list is set or its SKU or category is included, and neither
+// its SKU nor its category is excluded.
+func (v Voucher) appliesTo(line CartLine) bool {
+	if contains(v.ExcludeSKUs, line.SKU) || (line.CategoryID != "" && contains(v.ExcludeCategories, line.CategoryID)) {
+		return false
+	}
+	if len(v.IncludeSKUs) == 0 && len(v.IncludeCategories) == 0 {
+		return true
+	}
+	return contains(v.IncludeSKUs, line.SKU) || (line.CategoryID != "" && contains(v.IncludeCategories, line.CategoryID))
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// copyScopes sets the scope lists of v that are set in from.
+func (v *Voucher) copyScopes(from Voucher) {
+	for _, list := range scopeLists {
+		if values := *list.values(&from); values != nil {
+			*list.values(v) = values
+		}
+	}
+}
+
+// normalizeScopes trims, de-duplicates and sorts the scope lists of v that
+// are set, and rejects a value that is both included and excluded. SKUs and
+// category IDs are matched exactly, so their case is kept.
+func normalizeScopes(v *Voucher) *common.AppError {
+	for _, list := range scopeLists {
+		values := list.values(v)
+		if *values == nil {
+			continue
+		}
+		normalized, err := normalizeScopeValues(list.field, *values)
+		if err != nil {
+			return common.NewValidationError(err.Error(), nil)
+		}
+		*values = normalized
+	}
+
+	for _, pair := range [][2][]string{{v.IncludeSKUs, v.ExcludeSKUs}, {v.IncludeCategories, v.ExcludeCategories}} {
+		for _, value := range pair[0] {
+			if contains(pair[1], value) {
+				return common.NewValidationError(fmt.Sprintf("%q cannot be both included and excluded", value), nil)
+			}
+		}
+	}
+	return nil
+}
+
+func normalizeScopeValues(field string, raw []string) ([]string, error) {
+	seen := make(map[string]struct{}, len(raw))
+	values := make([]string, 0, len(raw))
+	for _, value := range raw {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		if len(value) > maxScopeValueLength {
+			return nil, fmt.Errorf("%s value %q must be at most %d characters", field, value, maxScopeValueLength)
+		}
+		if strings.Contains(value, csvListSeparator) {
+			return nil, fmt.Errorf("%s value %q must not contain %q", field, value, csvListSeparator)
+		}
+		if _, ok := seen[value]; ok {
+			continue
+		}
+		seen[value] = struct{}{}
+		values = append(values, value)
+	}
+	if len(values) > maxScopeValuesPerList {
+		return nil, fmt.Errorf("%s can have at most %d values", field, maxScopeValuesPerList)
+	}
+	sort.Strings(values)
+	return values, nil
+}
+
+// validateCart checks that the optional cart lines sent with an order add up
+// to its order amount.
+func validateCart(orderAmount int64, lines []CartLine) *common.AppError {
+	if len(lines) == 0 {
+		return nil
+	}
+	var total int64
+	for _, line := range lines {
+		lineTotal, ok := line.total()
+		if !ok {
+			return common.NewValidationError("quantity multiplied by unit_price is too large", nil)
+		}
+		var appErr *common.AppError
+		if total, appErr = addTotal(total, lineTotal); appErr != nil {
+			return appErr
+		}
+	}
+	if total != orderAmount {
+		return common.NewValidationError("order_amount must equal the total of the cart lines", nil)
+	}
+	return nil
+}
+
+// priceLines applies v to the eligible lines and spreads the discount over
+// them in proportion to their totals. The shares always add up to the
+// returned discount.
+func priceLines(v Voucher, lines []CartLine) ([]LineDiscount, int64, *common.AppError) {
+	priced := make([]LineDiscount, len(lines))
+	var (
+		eligibleTotal int64
+		eligible      []int
+	)
+	var subtotal int64
+	for i, line := range lines {
+		lineTotal, ok := line.total()
+		if !ok {
+			return nil, 0, common.NewValidationError("quantity multiplied by unit_price is too large", nil)
+		}
+		var appErr *common.AppError
+		if subtotal, appErr = addTotal(subtotal, lineTotal); appErr != nil {
+			return nil, 0, appErr
+		}
+		priced[i] = LineDiscount{CartLine: line, LineTotal: lineTotal, Eligible: v.appliesTo(line)}
+		if priced[i].Eligible {
+			eligibleTotal += lineTotal
+			eligible = append(eligible, i)
+		}
+	}
+	if len(eligible) == 0 {
+		return nil, 0, common.NewUnprocessableError("voucher does not apply to any line in the cart", nil)
+	}
+
+	discount, appErr := calculateDiscount(v, eligibleTotal)
+	if appErr != nil {
+		return nil, 0, appErr
+	}
+	if discount == 0 {
+		return priced, 0, nil
+	}
+
+	// Largest remainder: every line gets the floor of its exact share and
+	// the cents left over go to the lines with the largest remainders.
+	remainders := make([]int64, len(lines))
+	allocated := int64(0)
+	for _, i := range eligible {
+		share, remainder := mulDiv(discount, priced[i].LineTotal, eligibleTotal)
+		priced[i].DiscountAmount = share
+		remainders[i] = remainder
+		allocated += share
+	}
+	sort.SliceStable(eligible, func(a, b int) bool {
+		return remainders[eligible[a]] > remainders[eligible[b]]
+	})
+	for _, i := range eligible[:discount-allocated] {
+		priced[i].DiscountAmount++
+	}
+
+	return priced, discount, nil
+}
+
+// mulDiv returns a*b/c and its remainder without overflowing.
+func mulDiv(a, b, c int64) (int64, int64) {
+	quo, rem := new(big.Int).QuoRem(
+		new(big.Int).Mul(big.NewInt(a), big.NewInt(b)),
+		big.NewInt(c),
+		new(big.Int),
+	)
+	return quo.Int64(), rem.Int64()
+}
+
+// Calculate prices a cart with the voucher, applying it only to the lines
+// its product and category scope allows. It runs the checks Redeem would run
+// but nothing is redeemed or reserved.
+func (s *Service) Calculate(ctx context.Context, input CalculateDiscountInput) (Calculation, *common.AppError) {
+	code := s.codePolicy.Normalize(input.VoucherCode)
+	customer := newCustomer(input.CustomerID, input.CustomerEmail)
+	if len(input.Lines) > maxCartLines {
+		return Calculation{}, common.NewValidationError(fmt.Sprintf("a cart can have at most %d lines", maxCartLines), nil)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.QueryTimeout)
+	defer cancel()
+
+	if appErr := s.verifyCheckDigit(ctx, code); appErr != nil {
+		return Calculation{}, appErr
+	}
+
+	v, err := s.repo.GetByCode(ctx, code)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Calculation{}, common.NewNotFoundError("voucher not found", err)
+		}
+		return Calculation{}, common.NewInternalError("failed to fetch voucher", err)
+	}
+	if appErr := checkUsable(ctx, s.repo, v, customer, input.Currency); appErr != nil {
+		return Calculation{}, appErr
+	}
+
+	lines, discount, appErr := priceLines(v, input.Lines)
+	if appErr != nil {
+		return Calculation{}, appErr
+	}
+
+	result := Calculation{VoucherCode: v.VoucherCode, DiscountAmount: discount, Lines: lines}
+	for _, line := range lines {
+		result.Subtotal += line.LineTotal
+		if line.Eligible {
+			result.EligibleSubtotal += line.LineTotal
+		}
+	}
+	result.FinalAmount = result.Subtotal - discount
+	return result, nil
+}
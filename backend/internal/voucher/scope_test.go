@@ -0,0 +1,195 @@
+package voucher
+
+import (
+	"net/http"
+	"testing"
+)
+
+func cartLine(sku string, quantity, unitPrice int64) CartLine {
+	return CartLine{SKU: sku, Quantity: quantity, UnitPrice: unitPrice}
+}
+
+func TestPriceLines(t *testing.T) {
+	seven := int64(7)
+
+	tests := []struct {
+		name         string
+		voucher      Voucher
+		lines        []CartLine
+		wantDiscount int64
+		wantShares   []int64
+		wantEligible []bool
+	}{
+		{
+			// 10 over three equal lines: 3 each and the leftover cent
+			// goes to the first of the tied remainders.
+			name:         "ties keep cart order",
+			voucher:      Voucher{DiscountType: DiscountTypeFixedAmount, DiscountAmount: 10},
+			lines:        []CartLine{cartLine("A", 1, 100), cartLine("B", 1, 100), cartLine("C", 1, 100)},
+			wantDiscount: 10,
+			wantShares:   []int64{4, 3, 3},
+			wantEligible: []bool{true, true, true},
+		},
+		{
+			// Exact shares 33.3 and 66.7: the larger remainder gets the cent.
+			name:         "largest remainder rounds up",
+			voucher:      Voucher{DiscountType: DiscountTypeFixedAmount, DiscountAmount: 100},
+			lines:        []CartLine{cartLine("A", 1, 333), cartLine("B", 1, 667)},
+			wantDiscount: 100,
+			wantShares:   []int64{33, 67},
+			wantEligible: []bool{true, true},
+		},
+		{
+			name:         "quantity counts towards the share",
+			voucher:      Voucher{DiscountType: DiscountTypePercent, DiscountPercent: 10},
+			lines:        []CartLine{cartLine("A", 3, 100), cartLine("B", 1, 100)},
+			wantDiscount: 40,
+			wantShares:   []int64{30, 10},
+			wantEligible: []bool{true, true},
+		},
+		{
+			name:         "excluded lines get nothing",
+			voucher:      Voucher{DiscountType: DiscountTypePercent, DiscountPercent: 10, ExcludeSKUs: []string{"B"}},
+			lines:        []CartLine{cartLine("A", 1, 100), cartLine("B", 1, 100), cartLine("C", 1, 300)},
+			wantDiscount: 40,
+			wantShares:   []int64{10, 0, 30},
+			wantEligible: []bool{true, false, true},
+		},
+		{
+			name:         "only included lines are discounted",
+			voucher:      Voucher{DiscountType: DiscountTypePercent, DiscountPercent: 50, IncludeSKUs: []string{"B"}},
+			lines:        []CartLine{cartLine("A", 1, 100), cartLine("B", 1, 101)},
+			wantDiscount: 50,
+			wantShares:   []int64{0, 50},
+			wantEligible: []bool{false, true},
+		},
+		{
+			// 50% of 30 is capped at 7 and spread as 2.33 each.
+			name:         "cap applied before spreading",
+			voucher:      Voucher{DiscountType: DiscountTypePercent, DiscountPercent: 50, MaxDiscountAmount: &seven},
+			lines:        []CartLine{cartLine("A", 1, 10), cartLine("B", 1, 10), cartLine("C", 1, 10)},
+			wantDiscount: 7,
+			wantShares:   []int64{3, 2, 2},
+			wantEligible: []bool{true, true, true},
+		},
+		{
+			name:         "fixed amount capped by eligible total",
+			voucher:      Voucher{DiscountType: DiscountTypeFixedAmount, DiscountAmount: 1000, ExcludeSKUs: []string{"B"}},
+			lines:        []CartLine{cartLine("A", 1, 60), cartLine("B", 1, 500), cartLine("C", 2, 20)},
+			wantDiscount: 100,
+			wantShares:   []int64{60, 0, 40},
+			wantEligible: []bool{true, false, true},
+		},
+		{
+			name:         "free lines share nothing",
+			voucher:      Voucher{DiscountType: DiscountTypeFixedAmount, DiscountAmount: 5},
+			lines:        []CartLine{cartLine("A", 1, 0), cartLine("B", 1, 50)},
+			wantDiscount: 5,
+			wantShares:   []int64{0, 5},
+			wantEligible: []bool{true, true},
+		},
+		{
+			name:         "largest allowed line",
+			voucher:      Voucher{DiscountType: DiscountTypePercent, DiscountPercent: 100},
+			lines:        []CartLine{cartLine("A", 9, 1_000_000_000_000_000), cartLine("B", 1, 1)},
+			wantDiscount: 9_000_000_000_000_001,
+			wantShares:   []int64{9_000_000_000_000_000, 1},
+			wantEligible: []bool{true, true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			priced, discount, appErr := priceLines(tt.voucher, tt.lines)
+			if appErr != nil {
+				t.Fatalf("priceLines error: %v", appErr)
+			}
+			if discount != tt.wantDiscount {
+				t.Fatalf("discount = %d, want %d", discount, tt.wantDiscount)
+			}
+
+			var sum int64
+			for i, p := range priced {
+				if p.DiscountAmount != tt.wantShares[i] {
+					t.Errorf("line %d share = %d, want %d", i, p.DiscountAmount, tt.wantShares[i])
+				}
+				if p.Eligible != tt.wantEligible[i] {
+					t.Errorf("line %d eligible = %v, want %v", i, p.Eligible, tt.wantEligible[i])
+				}
+				if p.LineTotal != tt.lines[i].Quantity*tt.lines[i].UnitPrice {
+					t.Errorf("line %d total = %d, want %d", i, p.LineTotal, tt.lines[i].Quantity*tt.lines[i].UnitPrice)
+				}
+				sum += p.DiscountAmount
+			}
+			if sum != discount {
+				t.Fatalf("shares add up to %d, want %d", sum, discount)
+			}
+		})
+	}
+}
+
+func TestPriceLinesRejects(t *testing.T) {
+	percent := Voucher{DiscountType: DiscountTypePercent, DiscountPercent: 10}
+
+	tests := []struct {
+		name       string
+		voucher    Voucher
+		lines      []CartLine
+		wantStatus int
+	}{
+		{
+			name:       "no eligible line",
+			voucher:    Voucher{DiscountType: DiscountTypePercent, DiscountPercent: 10, IncludeSKUs: []string{"X"}},
+			lines:      []CartLine{cartLine("A", 1, 100)},
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "line total overflows",
+			voucher:    percent,
+			lines:      []CartLine{cartLine("A", 1_000_000, 1_000_000_000_000_000)},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "cart total overflows",
+			voucher:    percent,
+			lines:      []CartLine{cartLine("A", 1_000_000, 5_000_000_000_000), cartLine("B", 1_000_000, 5_000_000_000_000)},
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, appErr := priceLines(tt.voucher, tt.lines)
+			if appErr == nil {
+				t.Fatal("priceLines succeeded, want an error")
+			}
+			if appErr.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d (%s), want %d", appErr.StatusCode, appErr.Message, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestValidateCart(t *testing.T) {
+	tests := []struct {
+		name        string
+		orderAmount int64
+		lines       []CartLine
+		wantErr     bool
+	}{
+		{"no lines", 500, nil, false},
+		{"matching total", 500, []CartLine{cartLine("A", 2, 150), cartLine("B", 1, 200)}, false},
+		{"mismatched total", 499, []CartLine{cartLine("A", 2, 150), cartLine("B", 1, 200)}, true},
+		{"line total overflows", 1, []CartLine{cartLine("A", 1_000_000, 1_000_000_000_000_000)}, true},
+		{"cart total overflows", 1, []CartLine{cartLine("A", 1_000_000, 5_000_000_000_000), cartLine("B", 1_000_000, 5_000_000_000_000)}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			appErr := validateCart(tt.orderAmount, tt.lines)
+			if (appErr != nil) != tt.wantErr {
+				t.Fatalf("validateCart error = %v, want error %v", appErr, tt.wantErr)
+			}
+			if appErr != nil && appErr.StatusCode != http.StatusBadRequest {
+				t.Fatalf("status = %d, want %d", appErr.StatusCode, http.StatusBadRequest)
+			}
+		})
+	}
+}
@@ -1,38 +1,182 @@
 package voucher
 
 import (
+	"bytes"
 	"context"
+	"encoding/csv"
 	"errors"
 	"fmt"
 	"io"
 	"mime/multipart"
-	"strconv"
+	"net/http"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/mhakimsaputra17/discount-voucher-management/backend/internal/audit"
+	"github.com/mhakimsaputra17/discount-voucher-management/backend/internal/campaign"
+	"github.com/mhakimsaputra17/discount-voucher-management/backend/internal/codes"
 	"github.com/mhakimsaputra17/discount-voucher-management/backend/internal/common"
 	"github.com/mhakimsaputra17/discount-voucher-management/backend/internal/config"
 	"github.com/mhakimsaputra17/discount-voucher-management/backend/internal/logger"
 )
 
 type Service struct {
-	repo   *Repository
-	cfg    config.Config
-	logger *logger.Logger
+	repo        *Repository
+	campaigns   *campaign.Service
+	cfg         config.Config
+	logger      *logger.Logger
+	codePolicy  codes.Policy
+	checkDigits checkDigitFormats
 }
 
 type CreateVoucherInput struct {
-	VoucherCode     string `json:"voucher_code" binding:"required"`
-	DiscountPercent int    `json:"discount_percent" binding:"required,min=1,max=100"`
-	ExpiryDate      string `json:"expiry_date" binding:"required"`
+	VoucherCode               string   `json:"voucher_code" binding:"required"`
+	DiscountType              string   `json:"discount_type" binding:"omitempty,oneof=percent fixed_amount"`
+	DiscountPercent           int      `json:"discount_percent" binding:"omitempty,min=1,max=100"`
+	DiscountAmount            int64    `json:"discount_amount" binding:"omitempty,min=1"`
+	Currency                  string   `json:"currency" binding:"omitempty,len=3"`
+	MinOrderAmount            *int64   `json:"min_order_amount" binding:"omitempty,min=1"`
+	MaxDiscountAmount         *int64   `json:"max_discount_amount" binding:"omitempty,min=1"`
+	ValidFrom                 string   `json:"valid_from"`
+	ExpiryDate                string   `json:"expiry_date"`
+	Timezone                  *string  `json:"timezone"`
+	State                     string   `json:"state" binding:"omitempty,oneof=draft active"`
+	CampaignID                *int64   `json:"campaign_id" binding:"omitempty,min=1"`
+	MaxRedemptions            *int     `json:"max_redemptions" binding:"omitempty,min=1"`
+	MaxRedemptionsPerCustomer *int     `json:"max_redemptions_per_customer" binding:"omitempty,min=1"`
+	Stackable                 bool     `json:"stackable"`
+	ExclusivityGroup          *string  `json:"exclusivity_group"`
+	PersonalCustomerID        *string  `json:"personal_customer_id"`
+	AllowedCustomerIDs        []string `json:"allowed_customer_ids"`
+	AllowedEmailHashes        []string `json:"allowed_email_hashes"`
+	IncludeSKUs               []string `json:"include_skus"`
+	ExcludeSKUs               []string `json:"exclude_skus"`
+	IncludeCategories         []string `json:"include_categories"`
+	ExcludeCategories         []string `json:"exclude_categories"`
+	Tags                      []string `json:"tags"`
 }
 
 type UpdateVoucherInput struct {
-	VoucherCode     string `json:"voucher_code" binding:"required"`
-	DiscountPercent int    `json:"discount_percent" binding:"required,min=1,max=100"`
-	ExpiryDate      string `json:"expiry_date" binding:"required"`
+	VoucherCode               string   `json:"voucher_code" binding:"required"`
+	DiscountType              string   `json:"discount_type" binding:"omitempty,oneof=percent fixed_amount"`
+	DiscountPercent           int      `json:"discount_percent" binding:"omitempty,min=1,max=100"`
+	DiscountAmount            int64    `json:"discount_amount" binding:"omitempty,min=1"`
+	Currency                  string   `json:"currency" binding:"omitempty,len=3"`
+	MinOrderAmount            *int64   `json:"min_order_amount" binding:"omitempty,min=1"`
+	MaxDiscountAmount         *int64   `json:"max_discount_amount" binding:"omitempty,min=1"`
+	ValidFrom                 string   `json:"valid_from"`
+	ExpiryDate                string   `json:"expiry_date"`
+	Timezone                  *string  `json:"timezone"`
+	CampaignID                *int64   `json:"campaign_id" binding:"omitempty,min=1"`
+	MaxRedemptions            *int     `json:"max_redemptions" binding:"omitempty,min=1"`
+	MaxRedemptionsPerCustomer *int     `json:"max_redemptions_per_customer" binding:"omitempty,min=1"`
+	Stackable                 bool     `json:"stackable"`
+	ExclusivityGroup          *string  `json:"exclusivity_group"`
+	PersonalCustomerID        *string  `json:"personal_customer_id"`
+	AllowedCustomerIDs        []string `json:"allowed_customer_ids"`
+	AllowedEmailHashes        []string `json:"allowed_email_hashes"`
+	IncludeSKUs               []string `json:"include_skus"`
+	ExcludeSKUs               []string `json:"exclude_skus"`
+	IncludeCategories         []string `json:"include_categories"`
+	ExcludeCategories         []string `json:"exclude_categories"`
+	Tags                      []string `json:"tags"`
+}
+
+// GenerateVouchersInput describes a batch of vouchers that share every
+// attribute except their randomly generated code.
+type GenerateVouchersInput struct {
+	Prefix                    string   `json:"prefix"`
+	Count                     int      `json:"count" binding:"required,min=1,max=100000"`
+	CodeLength                int      `json:"code_length" binding:"omitempty,min=4,max=32"`
+	Charset                   string   `json:"charset" binding:"omitempty,oneof=alphanumeric letters digits"`
+	CheckDigit                *bool    `json:"check_digit"`
+	DiscountType              string   `json:"discount_type" binding:"omitempty,oneof=percent fixed_amount"`
+	DiscountPercent           int      `json:"discount_percent" binding:"omitempty,min=1,max=100"`
+	DiscountAmount            int64    `json:"discount_amount" binding:"omitempty,min=1"`
+	Currency                  string   `json:"currency" binding:"omitempty,len=3"`
+	MinOrderAmount            *int64   `json:"min_order_amount" binding:"omitempty,min=1"`
+	MaxDiscountAmount         *int64   `json:"max_discount_amount" binding:"omitempty,min=1"`
+	ValidFrom                 string   `json:"valid_from"`
+	ExpiryDate                string   `json:"expiry_date"`
+	Timezone                  *string  `json:"timezone"`
+	State                     string   `json:"state" binding:"omitempty,oneof=draft active"`
+	CampaignID                *int64   `json:"campaign_id" binding:"omitempty,min=1"`
+	MaxRedemptions            *int     `json:"max_redemptions" binding:"omitempty,min=1"`
+	MaxRedemptionsPerCustomer *int     `json:"max_redemptions_per_customer" binding:"omitempty,min=1"`
+	Stackable                 bool     `json:"stackable"`
+	ExclusivityGroup          *string  `json:"exclusivity_group"`
+	PersonalCustomerID        *string  `json:"personal_customer_id"`
+	AllowedCustomerIDs        []string `json:"allowed_customer_ids"`
+	AllowedEmailHashes        []string `json:"allowed_email_hashes"`
+	IncludeSKUs               []string `json:"include_skus"`
+	ExcludeSKUs               []string `json:"exclude_skus"`
+	IncludeCategories         []string `json:"include_categories"`
+	ExcludeCategories         []string `json:"exclude_categories"`
+	Tags                      []string `json:"tags"`
+}
+
+type GenerateVouchersResult struct {
+	Count int      `json:"count"`
+	Codes []string `json:"codes"`
+}
+
+// CloneVoucherInput lists the codes a voucher is cloned into: either Codes
+// explicitly, or Count random codes built like POST /vouchers/generate.
+type CloneVoucherInput struct {
+	Codes      []string `json:"codes" binding:"omitempty,max=1000"`
+	Prefix     string   `json:"prefix"`
+	Count      int      `json:"count" binding:"omitempty,min=1,max=100000"`
+	CodeLength int      `json:"code_length" binding:"omitempty,min=4,max=32"`
+	Charset    string   `json:"charset" binding:"omitempty,oneof=alphanumeric letters digits"`
+	CheckDigit *bool    `json:"check_digit"`
+}
+
+// CloneResult reports, like CSVImportResult, what happened to every
+// requested code.
+type CloneResult struct {
+	TotalCodes   int           `json:"total_codes"`
+	SuccessCount int           `json:"success_count"`
+	FailureCount int           `json:"failure_count"`
+	Results      []CloneStatus `json:"results"`
+}
+
+// CloneStatus is the outcome for one code: VoucherID is set when the clone
+// was created and Reason when it was not.
+type CloneStatus struct {
+	VoucherCode string `json:"voucher_code"`
+	VoucherID   *int64 `json:"voucher_id,omitempty"`
+	Reason      string `json:"reason,omitempty"`
+}
+
+type RevertVoucherInput struct {
+	Version int `json:"version" binding:"required,min=1"`
+}
+
+type TransitionVoucherInput struct {
+	State string `json:"state" binding:"required,oneof=draft active paused archived"`
+}
+
+type RedeemVoucherInput struct {
+	VoucherCode    string     `json:"voucher_code" binding:"required"`
+	CustomerID     string     `json:"customer_id"`
+	CustomerEmail  string     `json:"customer_email" binding:"omitempty,email"`
+	OrderReference string     `json:"order_reference" binding:"required"`
+	OrderAmount    int64      `json:"order_amount" binding:"required,min=1"`
+	Currency       string     `json:"currency" binding:"omitempty,len=3"`
+	Lines          []CartLine `json:"lines" binding:"omitempty,max=500,dive"`
+}
+
+type ReserveVoucherInput struct {
+	CustomerID     string     `json:"customer_id"`
+	CustomerEmail  string     `json:"customer_email" binding:"omitempty,email"`
+	OrderReference string     `json:"order_reference" binding:"required"`
+	OrderAmount    int64      `json:"order_amount" binding:"required,min=1"`
+	Currency       string     `json:"currency" binding:"omitempty,len=3"`
+	Lines          []CartLine `json:"lines" binding:"omitempty,max=500,dive"`
+	TTLSeconds     int        `json:"ttl_seconds" binding:"omitempty,min=30,max=86400"`
 }
 
 type CSVImportResult struct {
@@ -47,11 +191,118 @@ type CSVImportStatus struct {
 	Reason string `json:"reason"`
 }
 
-func NewService(repo *Repository, cfg config.Config, logger *logger.Logger) *Service {
-	return &Service{repo: repo, cfg: cfg, logger: logger}
+func NewService(repo *Repository, campaigns *campaign.Service, cfg config.Config, logger *logger.Logger) *Service {
+	return &Service{
+		repo:       repo,
+		campaigns:  campaigns,
+		cfg:        cfg,
+		logger:     logger,
+		codePolicy: codes.NewPolicy(cfg.VoucherCodeCase),
+	}
+}
+
+func (in CreateVoucherInput) toVoucher() Voucher {
+	return Voucher{
+		VoucherCode:               in.VoucherCode,
+		State:                     in.State,
+		DiscountType:              in.DiscountType,
+		DiscountPercent:           in.DiscountPercent,
+		DiscountAmount:            in.DiscountAmount,
+		Currency:                  in.Currency,
+		MinOrderAmount:            in.MinOrderAmount,
+		MaxDiscountAmount:         in.MaxDiscountAmount,
+		ValidFrom:                 in.ValidFrom,
+		ExpiryDate:                in.ExpiryDate,
+		Timezone:                  in.Timezone,
+		CampaignID:                in.CampaignID,
+		MaxRedemptions:            in.MaxRedemptions,
+		MaxRedemptionsPerCustomer: in.MaxRedemptionsPerCustomer,
+		Stackable:                 in.Stackable,
+		ExclusivityGroup:          in.ExclusivityGroup,
+		PersonalCustomerID:        in.PersonalCustomerID,
+		AllowedCustomerIDs:        in.AllowedCustomerIDs,
+		AllowedEmailHashes:        in.AllowedEmailHashes,
+		IncludeSKUs:               in.IncludeSKUs,
+		ExcludeSKUs:               in.ExcludeSKUs,
+		IncludeCategories:         in.IncludeCategories,
+		ExcludeCategories:         in.ExcludeCategories,
+		Tags:                      in.Tags,
+	}
+}
+
+func (in UpdateVoucherInput) toVoucher() Voucher {
+	return Voucher{
+		VoucherCode:               in.VoucherCode,
+		DiscountType:              in.DiscountType,
+		DiscountPercent:           in.DiscountPercent,
+		DiscountAmount:            in.DiscountAmount,
+		Currency:                  in.Currency,
+		MinOrderAmount:            in.MinOrderAmount,
+		MaxDiscountAmount:         in.MaxDiscountAmount,
+		ValidFrom:                 in.ValidFrom,
+		ExpiryDate:                in.ExpiryDate,
+		Timezone:                  in.Timezone,
+		CampaignID:                in.CampaignID,
+		MaxRedemptions:            in.MaxRedemptions,
+		MaxRedemptionsPerCustomer: in.MaxRedemptionsPerCustomer,
+		Stackable:                 in.Stackable,
+		ExclusivityGroup:          in.ExclusivityGroup,
+		PersonalCustomerID:        in.PersonalCustomerID,
+		AllowedCustomerIDs:        in.AllowedCustomerIDs,
+		AllowedEmailHashes:        in.AllowedEmailHashes,
+		IncludeSKUs:               in.IncludeSKUs,
+		ExcludeSKUs:               in.ExcludeSKUs,
+		IncludeCategories:         in.IncludeCategories,
+		ExcludeCategories:         in.ExcludeCategories,
+		Tags:                      in.Tags,
+	}
+}
+
+func (in GenerateVouchersInput) toVoucher() Voucher {
+	return Voucher{
+		State:                     in.State,
+		DiscountType:              in.DiscountType,
+		DiscountPercent:           in.DiscountPercent,
+		DiscountAmount:            in.DiscountAmount,
+		Currency:                  in.Currency,
+		MinOrderAmount:            in.MinOrderAmount,
+		MaxDiscountAmount:         in.MaxDiscountAmount,
+		ValidFrom:                 in.ValidFrom,
+		ExpiryDate:                in.ExpiryDate,
+		Timezone:                  in.Timezone,
+		CampaignID:                in.CampaignID,
+		MaxRedemptions:            in.MaxRedemptions,
+		MaxRedemptionsPerCustomer: in.MaxRedemptionsPerCustomer,
+		Stackable:                 in.Stackable,
+		ExclusivityGroup:          in.ExclusivityGroup,
+		PersonalCustomerID:        in.PersonalCustomerID,
+		AllowedCustomerIDs:        in.AllowedCustomerIDs,
+		AllowedEmailHashes:        in.AllowedEmailHashes,
+		IncludeSKUs:               in.IncludeSKUs,
+		ExcludeSKUs:               in.ExcludeSKUs,
+		IncludeCategories:         in.IncludeCategories,
+		ExcludeCategories:         in.ExcludeCategories,
+		Tags:                      in.Tags,
+	}
 }
 
 func (s *Service) List(ctx context.Context, params ListParams) (ListResponse, *common.AppError) {
+	switch params.Status {
+	case "", StatusScheduled, StatusActive, StatusExpired:
+	default:
+		return ListResponse{}, common.NewValidationError("status must be one of scheduled, active, expired", nil)
+	}
+	if _, ok := stateTransitions[params.State]; params.State != "" && !ok {
+		return ListResponse{}, common.NewValidationError("state must be one of draft, active, paused, archived", nil)
+	}
+	if len(params.Tags) > 0 {
+		tags, err := normalizeTags(params.Tags)
+		if err != nil {
+			return ListResponse{}, common.NewValidationError(err.Error(), nil)
+		}
+		params.Tags = tags
+	}
+
 	limit := params.Limit
 	if limit <= 0 {
 		limit = 10
@@ -88,15 +339,33 @@ func (s *Service) List(ctx context.Context, params ListParams) (ListResponse, *c
 	}, nil
 }
 
-func (s *Service) Create(ctx context.Context, input CreateVoucherInput) (Voucher, *common.AppError) {
-	if err := validateDate(input.ExpiryDate); err != nil {
-		return Voucher{}, common.NewValidationError("expiry_date must be in YYYY-MM-DD format", err)
+func (s *Service) ListTags(ctx context.Context) ([]Tag, *common.AppError) {
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.QueryTimeout)
+	defer cancel()
+
+	tags, err := s.repo.ListTags(ctx)
+	if err != nil {
+		return nil, common.NewInternalError("failed to list tags", err)
 	}
+	return tags, nil
+}
 
+func (s *Service) Create(ctx context.Context, input CreateVoucherInput) (Voucher, *common.AppError) {
 	ctx, cancel := context.WithTimeout(ctx, s.cfg.QueryTimeout)
 	defer cancel()
 
-	exists, err := s.repo.ExistsByCode(ctx, input.VoucherCode, nil)
+	v := input.toVoucher()
+	if appErr := s.applyCampaignDefaults(ctx, &v, nil); appErr != nil {
+		return Voucher{}, appErr
+	}
+	if appErr := s.prepareVoucher(&v); appErr != nil {
+		return Voucher{}, appErr
+	}
+	if appErr := s.verifyCheckDigit(ctx, v.VoucherCode); appErr != nil {
+		return Voucher{}, appErr
+	}
+
+	exists, err := s.repo.ExistsByCode(ctx, v.VoucherCode, nil)
 	if err != nil {
 		return Voucher{}, common.NewInternalError("failed to validate voucher code", err)
 	}
@@ -104,13 +373,17 @@ func (s *Service) Create(ctx context.Context, input CreateVoucherInput) (Voucher
 		return Voucher{}, common.NewConflictError("voucher_code already exists", nil)
 	}
 
-	created, err := s.repo.Create(ctx, Voucher{
-		VoucherCode:     strings.TrimSpace(input.VoucherCode),
-		DiscountPercent: input.DiscountPercent,
-		ExpiryDate:      input.ExpiryDate,
+	var created Voucher
+	err = s.repo.WithTx(ctx, func(tx *Repository) error {
+		var err error
+		created, err = tx.Create(ctx, v)
+		if err != nil {
+			return handlePgxError(err)
+		}
+		return recordAudit(ctx, tx, audit.ActionCreate, nil, &created)
 	})
 	if err != nil {
-		return Voucher{}, handlePgxError(err)
+		return Voucher{}, toAppError(err, "failed to create voucher")
 	}
 
 	return created, nil
@@ -131,17 +404,107 @@ func (s *Service) Get(ctx context.Context, id int64) (Voucher, *common.AppError)
 	return voucher, nil
 }
 
-func (s *Service) Update(ctx context.Context, id int64, input UpdateVoucherInput) (Voucher, *common.AppError) {
-	if err := validateDate(input.ExpiryDate); err != nil {
-		return Voucher{}, common.NewValidationError("expiry_date must be in YYYY-MM-DD format", err)
+// Patch applies a JSON Merge Patch to a voucher. The voucher row is locked
+// while the patch is merged and validated, and written back in one UPDATE.
+func (s *Service) Patch(ctx context.Context, id int64, patch VoucherPatch, ifMatch IfMatch) (Voucher, *common.AppError) {
+	if appErr := s.checkIfMatchPresent(ifMatch); appErr != nil {
+		return Voucher{}, appErr
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.QueryTimeout)
+	defer cancel()
+
+	var updated Voucher
+	err := s.repo.WithTx(ctx, func(tx *Repository) error {
+		current, err := tx.GetByIDForUpdate(ctx, id)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return common.NewNotFoundError("voucher not found", err)
+			}
+			return common.NewInternalError("failed to fetch voucher", err)
+		}
+		if !ifMatch.matches(current.Version) {
+			return common.NewPreconditionFailedError("voucher has been modified since it was loaded", nil)
+		}
+
+		v := current
+		if appErr := patch.apply(&v); appErr != nil {
+			return appErr
+		}
+		if appErr := s.prepareVoucher(&v); appErr != nil {
+			return appErr
+		}
+		if appErr := s.verifyCheckDigit(ctx, v.VoucherCode); appErr != nil {
+			return appErr
+		}
+
+		exists, err := tx.ExistsByCode(ctx, v.VoucherCode, &id)
+		if err != nil {
+			return common.NewInternalError("failed to validate voucher code", err)
+		}
+		if exists {
+			return common.NewConflictError("voucher_code already exists", nil)
+		}
+
+		updated, err = tx.Update(ctx, id, v, nil)
+		if err != nil {
+			return handlePgxError(err)
+		}
+		return recordAudit(ctx, tx, audit.ActionUpdate, &current, &updated)
+	})
+	if err != nil {
+		return Voucher{}, toAppError(err, "failed to patch voucher")
+	}
+
+	return updated, nil
+}
+
+// Lookup finds a live voucher by its exact code. Codes with a bad check
+// character are rejected before the database is queried.
+func (s *Service) Lookup(ctx context.Context, code string) (Voucher, *common.AppError) {
+	code = s.codePolicy.Normalize(code)
+	if code == "" {
+		return Voucher{}, common.NewValidationError("code is required", nil)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.QueryTimeout)
+	defer cancel()
+
+	if appErr := s.verifyCheckDigit(ctx, code); appErr != nil {
+		return Voucher{}, appErr
+	}
+
+	voucher, err := s.repo.GetByCode(ctx, code)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Voucher{}, common.NewNotFoundError("voucher not found", err)
+		}
+		return Voucher{}, common.NewInternalError("failed to fetch voucher", err)
+	}
+
+	return voucher, nil
+}
+
+func (s *Service) Update(ctx context.Context, id int64, input UpdateVoucherInput, ifMatch IfMatch) (Voucher, *common.AppError) {
+	if appErr := s.checkIfMatchPresent(ifMatch); appErr != nil {
+		return Voucher{}, appErr
+	}
+
+	v := input.toVoucher()
+	if appErr := s.prepareVoucher(&v); appErr != nil {
+		return Voucher{}, appErr
 	}
 
 	ctx, cancel := context.WithTimeout(ctx, s.cfg.QueryTimeout)
 	defer cancel()
 
+	if appErr := s.verifyCheckDigit(ctx, v.VoucherCode); appErr != nil {
+		return Voucher{}, appErr
+	}
+
 	excludeID := new(int64)
 	*excludeID = id
-	exists, err := s.repo.ExistsByCode(ctx, input.VoucherCode, excludeID)
+	exists, err := s.repo.ExistsByCode(ctx, v.VoucherCode, excludeID)
 	if err != nil {
 		return Voucher{}, common.NewInternalError("failed to validate voucher code", err)
 	}
@@ -149,14 +512,30 @@ func (s *Service) Update(ctx context.Context, id int64, input UpdateVoucherInput
 		return Voucher{}, common.NewConflictError("voucher_code already exists", nil)
 	}
 
-	updated, err := s.repo.Update(ctx, id, Voucher{
-		VoucherCode:     strings.TrimSpace(input.VoucherCode),
-		DiscountPercent: input.DiscountPercent,
-		ExpiryDate:      input.ExpiryDate,
+	var updated Voucher
+	err = s.repo.WithTx(ctx, func(tx *Repository) error {
+		before, err := tx.GetByIDForUpdate(ctx, id)
+		if err != nil {
+			return err
+		}
+		// The allowlists a PUT omits are kept, so the personal check needs
+		// the locked current row.
+		if appErr := checkReplacedTargeting(before, v); appErr != nil {
+			return appErr
+		}
+		updated, err = tx.Update(ctx, id, v, ifMatch.versions())
+		if err != nil {
+			return err
+		}
+		return recordAudit(ctx, tx, audit.ActionUpdate, &before, &updated)
 	})
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
-			return Voucher{}, common.NewNotFoundError("voucher not found", err)
+			return Voucher{}, s.notFoundOrPreconditionFailed(ctx, id, ifMatch, err)
+		}
+		var appErr *common.AppError
+		if errors.As(err, &appErr) {
+			return Voucher{}, appErr
 		}
 		return Voucher{}, handlePgxError(err)
 	}
@@ -164,160 +543,1395 @@ func (s *Service) Update(ctx context.Context, id int64, input UpdateVoucherInput
 	return updated, nil
 }
 
-func (s *Service) Delete(ctx context.Context, id int64) *common.AppError {
+// ListVersions returns the prior versions of a live voucher, newest first.
+// The current version is the voucher itself.
+func (s *Service) ListVersions(ctx context.Context, id int64) ([]VoucherVersion, *common.AppError) {
 	ctx, cancel := context.WithTimeout(ctx, s.cfg.QueryTimeout)
 	defer cancel()
 
-	err := s.repo.Delete(ctx, id)
-	if err != nil {
+	if _, err := s.repo.GetByID(ctx, id); err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
-			return common.NewNotFoundError("voucher not found", err)
+			return nil, common.NewNotFoundError("voucher not found", err)
 		}
-		return common.NewInternalError("failed to delete voucher", err)
+		return nil, common.NewInternalError("failed to fetch voucher", err)
 	}
 
-	return nil
+	versions, err := s.repo.ListVersions(ctx, id)
+	if err != nil {
+		return nil, common.NewInternalError("failed to list voucher versions", err)
+	}
+	if versions == nil {
+		versions = make([]VoucherVersion, 0)
+	}
+	return versions, nil
 }
 
-func (s *Service) UploadCSV(ctx context.Context, fileHeader *multipart.FileHeader) (CSVImportResult, *common.AppError) {
-	if fileHeader.Size > s.cfg.CSVMaxSizeBytes {
-		return CSVImportResult{}, common.NewValidationError("file size exceeds limit", nil)
+// Revert restores the code, discount, dates and time zone of a prior
+// version. Every other attribute keeps its current value. The revert goes
+// through Update, so it is validated like any other edit and becomes a new
+// version itself.
+func (s *Service) Revert(ctx context.Context, id int64, input RevertVoucherInput, ifMatch IfMatch) (Voucher, *common.AppError) {
+	if appErr := s.checkIfMatchPresent(ifMatch); appErr != nil {
+		return Voucher{}, appErr
 	}
 
-	file, err := fileHeader.Open()
+	readCtx, cancel := context.WithTimeout(ctx, s.cfg.QueryTimeout)
+	defer cancel()
+
+	current, err := s.repo.GetByID(readCtx, id)
 	if err != nil {
-		return CSVImportResult{}, common.NewValidationError("unable to open file", err)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Voucher{}, common.NewNotFoundError("voucher not found", err)
+		}
+		return Voucher{}, common.NewInternalError("failed to fetch voucher", err)
+	}
+	if !ifMatch.matches(current.Version) {
+		return Voucher{}, common.NewPreconditionFailedError("voucher has been modified since it was loaded", nil)
+	}
+	if input.Version == current.Version {
+		return Voucher{}, common.NewConflictError(fmt.Sprintf("voucher is already at version %d", current.Version), nil)
 	}
-	defer file.Close()
 
-	content, err := io.ReadAll(io.LimitReader(file, s.cfg.CSVMaxSizeBytes+1))
+	target, err := s.repo.GetVersion(readCtx, id, input.Version)
 	if err != nil {
-		return CSVImportResult{}, common.NewValidationError("failed to read file", err)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Voucher{}, common.NewNotFoundError("voucher version not found", err)
+		}
+		return Voucher{}, common.NewInternalError("failed to fetch voucher version", err)
+	}
+	old := target.Voucher
+
+	update := UpdateVoucherInput{
+		VoucherCode:               old.VoucherCode,
+		DiscountType:              old.DiscountType,
+		DiscountPercent:           old.DiscountPercent,
+		DiscountAmount:            old.DiscountAmount,
+		Currency:                  old.Currency,
+		MinOrderAmount:            old.MinOrderAmount,
+		MaxDiscountAmount:         old.MaxDiscountAmount,
+		ValidFrom:                 old.ValidFrom,
+		ExpiryDate:                old.ExpiryDate,
+		Timezone:                  old.Timezone,
+		CampaignID:                current.CampaignID,
+		MaxRedemptions:            current.MaxRedemptions,
+		MaxRedemptionsPerCustomer: current.MaxRedemptionsPerCustomer,
+		Stackable:                 current.Stackable,
+		ExclusivityGroup:          current.ExclusivityGroup,
+		PersonalCustomerID:        current.PersonalCustomerID,
 	}
+	// Pin the update to the version read above so the attributes copied from
+	// it cannot overwrite a concurrent edit.
+	return s.Update(ctx, id, update, IfMatch{Present: true, Versions: []int{current.Version}})
+}
 
-	rows := strings.Split(strings.TrimSpace(string(content)), "\n")
-	if len(rows) == 0 {
-		return CSVImportResult{}, common.NewValidationError("empty file", nil)
+func (s *Service) Delete(ctx context.Context, id int64, ifMatch IfMatch) *common.AppError {
+	if appErr := s.checkIfMatchPresent(ifMatch); appErr != nil {
+		return appErr
 	}
 
-	header := strings.TrimSpace(rows[0])
-	if !strings.EqualFold(header, "voucher_code,discount_percent,expiry_date") {
-		return CSVImportResult{}, common.NewValidationError("invalid CSV header", nil)
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.QueryTimeout)
+	defer cancel()
+
+	err := s.repo.WithTx(ctx, func(tx *Repository) error {
+		before, err := tx.GetByIDForUpdate(ctx, id)
+		if err != nil {
+			return err
+		}
+		deleted, err := tx.Delete(ctx, id, ifMatch.versions())
+		if err != nil {
+			return err
+		}
+		return recordAudit(ctx, tx, audit.ActionDelete, &before, &deleted)
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return s.notFoundOrPreconditionFailed(ctx, id, ifMatch, err)
+		}
+		return common.NewInternalError("failed to delete voucher", err)
 	}
 
-	result := CSVImportResult{TotalRows: len(rows) - 1}
-	seenCodes := make(map[string]struct{})
+	return nil
+}
 
-	ctx, cancel := context.WithTimeout(ctx, s.cfg.QueryTimeout*2)
+func (s *Service) Restore(ctx context.Context, id int64) (Voucher, *common.AppError) {
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.QueryTimeout)
 	defer cancel()
 
-	for i, row := range rows[1:] {
-		line := strings.TrimSpace(row)
-		if line == "" {
-			result.FailureCount++
-			result.Failures = append(result.Failures, CSVImportStatus{Row: i + 1, Reason: "empty row"})
-			continue
+	var restored Voucher
+	err := s.repo.WithTx(ctx, func(tx *Repository) error {
+		before, err := tx.GetDeletedByIDForUpdate(ctx, id)
+		if err != nil {
+			return err
 		}
-
-		cols := strings.Split(line, ",")
-		if len(cols) != 3 {
-			result.FailureCount++
-			result.Failures = append(result.Failures, CSVImportStatus{Row: i + 1, Reason: "invalid column count"})
-			continue
+		restored, err = tx.Restore(ctx, id)
+		if err != nil {
+			return err
+		}
+		return recordAudit(ctx, tx, audit.ActionRestore, &before, &restored)
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Voucher{}, common.NewNotFoundError("voucher not found in trash", err)
 		}
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return Voucher{}, common.NewConflictError("voucher_code is already used by another voucher", err)
+		}
+		return Voucher{}, common.NewInternalError("failed to restore voucher", err)
+	}
 
-		code := strings.TrimSpace(cols[0])
-		percentStr := strings.TrimSpace(cols[1])
-		expiry := strings.TrimSpace(cols[2])
+	return restored, nil
+}
 
-		if code == "" {
-			result.FailureCount++
-			result.Failures = append(result.Failures, CSVImportStatus{Row: i + 1, Reason: "voucher_code required"})
-			continue
-		}
+// Purge permanently removes a voucher from the trash. Vouchers that have been
+// redeemed cannot be purged because the redemption ledger references them.
+func (s *Service) Purge(ctx context.Context, id int64) *common.AppError {
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.QueryTimeout)
+	defer cancel()
 
-		if _, exists := seenCodes[strings.ToLower(code)]; exists {
-			result.FailureCount++
-			result.Failures = append(result.Failures, CSVImportStatus{Row: i + 1, Reason: "duplicate voucher_code in file"})
-			continue
+	err := s.repo.WithTx(ctx, func(tx *Repository) error {
+		before, err := tx.GetDeletedByIDForUpdate(ctx, id)
+		if err != nil {
+			return err
 		}
-
-		percent, err := strconv.Atoi(percentStr)
-		if err != nil || percent < 1 || percent > 100 {
-			result.FailureCount++
-			result.Failures = append(result.Failures, CSVImportStatus{Row: i + 1, Reason: "discount_percent must be integer between 1 and 100"})
-			continue
+		if err := tx.Purge(ctx, id); err != nil {
+			return err
+		}
+		return recordAudit(ctx, tx, audit.ActionPurge, &before, nil)
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return common.NewNotFoundError("voucher not found in trash", err)
 		}
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23503" {
+			return common.NewConflictError("voucher has redemptions or reservations and cannot be purged", err)
+		}
+		return common.NewInternalError("failed to purge voucher", err)
+	}
 
-		if err := validateDate(expiry); err != nil {
-			result.FailureCount++
-			result.Failures = append(result.Failures, CSVImportStatus{Row: i + 1, Reason: "expiry_date must be YYYY-MM-DD"})
-			continue
+	return nil
+}
+
+// Generate creates input.Count vouchers with random unique codes. Codes are
+// inserted in batches; a code that collides with an existing voucher is
+// simply replaced by a fresh one in the next batch, so the database unique
+// index is the only uniqueness check. Every batch is committed on its own,
+// so a failure part way keeps the vouchers of the batches before it.
+func (s *Service) Generate(ctx context.Context, input GenerateVouchersInput) (GenerateVouchersResult, *common.AppError) {
+	generated, appErr := s.generate(ctx, input)
+	if appErr != nil {
+		return GenerateVouchersResult{}, appErr
+	}
+
+	voucherCodes := make([]string, len(generated))
+	for i, v := range generated {
+		voucherCodes[i] = v.VoucherCode
+	}
+	return GenerateVouchersResult{Count: len(voucherCodes), Codes: voucherCodes}, nil
+}
+
+// generate implements Generate and returns the created vouchers.
+func (s *Service) generate(ctx context.Context, input GenerateVouchersInput) ([]Voucher, *common.AppError) {
+	prefix := strings.ToUpper(strings.TrimSpace(input.Prefix))
+	if len(prefix) > maxCodePrefixLength {
+		return nil, common.NewValidationError(fmt.Sprintf("prefix must be at most %d characters", maxCodePrefixLength), nil)
+	}
+	for _, r := range prefix {
+		if (r < 'A' || r > 'Z') && (r < '0' || r > '9') && r != '-' && r != '_' {
+			return nil, common.NewValidationError("prefix may only contain letters, digits, '-' and '_'", nil)
 		}
+	}
+
+	setupCtx, cancel := context.WithTimeout(ctx, s.cfg.QueryTimeout)
+	defer cancel()
 
-		exists, err := s.repo.ExistsByCode(ctx, code, nil)
+	template := input.toVoucher()
+	campaigns := make(map[int64]campaign.Campaign, 1)
+	if appErr := s.applyCampaignDefaults(setupCtx, &template, campaigns); appErr != nil {
+		return nil, appErr
+	}
+	if appErr := s.prepareVoucher(&template); appErr != nil {
+		return nil, appErr
+	}
+	// A personal voucher is single-use; many of them for the same customer
+	// would multiply that one use.
+	if template.PersonalCustomerID != nil && input.Count > 1 {
+		return nil, common.NewValidationError("personal_customer_id can only be set when count is 1; use CSV import to issue personal vouchers to many customers", nil)
+	}
+
+	// check_digit follows the campaign unless the request overrides it.
+	checkDigit := false
+	if input.CheckDigit != nil {
+		checkDigit = *input.CheckDigit
+	} else if template.CampaignID != nil {
+		checkDigit = campaigns[*template.CampaignID].CheckDigit
+	}
+
+	format := codes.Format{Prefix: prefix, Charset: input.Charset}
+	if format.Charset == "" {
+		format.Charset = codes.CharsetAlphanumeric
+	}
+	length := input.CodeLength
+	if length == 0 {
+		length = defaultGeneratedCodeLength
+	}
+	generator, err := codes.NewGenerator(prefix, format.Charset, length, checkDigit)
+	if err != nil {
+		return nil, common.NewValidationError(err.Error(), nil)
+	}
+	// Keep the batch sparse in the code space so collisions stay rare and
+	// the retry loop below terminates quickly.
+	if generator.Space() < float64(input.Count)*generatedCodeSpaceFactor {
+		return nil, common.NewValidationError("code_length is too short for the requested count with this charset", nil)
+	}
+
+	formats, err := s.repo.ListCheckDigitFormats(setupCtx)
+	if err != nil {
+		return nil, common.NewInternalError("failed to load check-digit formats", err)
+	}
+	if checkDigit && prefix == "" {
+		return nil, common.NewValidationError("prefix is required when check_digit is enabled", nil)
+	}
+	if registered, ok := codes.Match(formats, prefix); ok && !checkDigit {
+		return nil, common.NewValidationError(fmt.Sprintf("prefix %q is reserved for check-digit codes", registered.Prefix), nil)
+	}
+	// A code must never land under a check-digit prefix other than its own,
+	// e.g. a random "BF" code starting with a registered "BF2".
+	skip := func(code string) bool {
+		f, ok := codes.Match(formats, code)
+		return ok && (!checkDigit || f.Prefix != prefix)
+	}
+
+	if checkDigit {
+		registered, err := s.repo.RegisterCheckDigitFormat(setupCtx, format)
 		if err != nil {
-			return CSVImportResult{}, common.NewInternalError("failed to check voucher code", err)
+			return nil, common.NewInternalError("failed to register check-digit format", err)
 		}
-		if exists {
-			result.FailureCount++
-			result.Failures = append(result.Failures, CSVImportStatus{Row: i + 1, Reason: "voucher_code already exists"})
-			continue
+		if registered != format {
+			return nil, common.NewConflictError(fmt.Sprintf("prefix %q is already used for check-digit codes with charset %s", prefix, registered.Charset), nil)
 		}
+		s.checkDigits.invalidate()
+	}
 
-		_, err = s.repo.Create(ctx, Voucher{
-			VoucherCode:     code,
-			DiscountPercent: percent,
-			ExpiryDate:      expiry,
-		})
+	generated := make([]Voucher, 0, input.Count)
+	attempted := make(map[string]struct{}, input.Count)
+	shortBatches := 0
+	for len(generated) < input.Count {
+		n := min(input.Count-len(generated), generateBatchSize)
+		batch, err := generator.Batch(n, attempted, skip)
 		if err != nil {
-			result.FailureCount++
-			result.Failures = append(result.Failures, CSVImportStatus{Row: i + 1, Reason: "failed to insert voucher"})
-			s.logger.Errorf("csv import failed for row %d: %v", i+1, err)
-			continue
+			return nil, generateFailed(err, len(generated), input.Count)
+		}
+		for _, code := range batch {
+			attempted[code] = struct{}{}
 		}
 
-		seenCodes[strings.ToLower(code)] = struct{}{}
-		result.SuccessCount++
+		inserted, err := s.insertGeneratedBatch(ctx, template, batch)
+		if err != nil {
+			return nil, generateFailed(err, len(generated), input.Count)
+		}
+		generated = append(generated, inserted...)
+		if len(inserted) < len(batch) {
+			// Collisions: the shortfall is retried with fresh codes.
+			shortBatches++
+			if shortBatches == maxGenerateRounds {
+				return nil, generateFailed(errGenerateExhausted, len(generated), input.Count)
+			}
+		}
 	}
 
-	if result.Failures == nil {
-		result.Failures = make([]CSVImportStatus, 0)
-	}
+	s.logger.Infof("generated %d vouchers with prefix %q", len(generated), prefix)
 
-	return result, nil
+	return generated, nil
 }
 
-func (s *Service) Export(ctx context.Context) ([]byte, *common.AppError) {
+// insertGeneratedBatch inserts one batch of generated vouchers in its own
+// transaction and time budget, together with an audit entry for each
+// voucher, written in one insert. Codes that are already taken are skipped.
+func (s *Service) insertGeneratedBatch(ctx context.Context, template Voucher, batch []string) ([]Voucher, error) {
 	ctx, cancel := context.WithTimeout(ctx, s.cfg.QueryTimeout*2)
 	defer cancel()
 
-	vouchers, err := s.repo.GetAll(ctx)
-	if err != nil {
-		return nil, common.NewInternalError("failed to export vouchers", err)
-	}
+	var inserted []Voucher
+	err := s.repo.WithTx(ctx, func(tx *Repository) error {
+		var err error
+		inserted, err = tx.CreateBatch(ctx, template, batch)
+		if err != nil || len(inserted) == 0 {
+			return err
+		}
+		entries := make([]audit.Entry, len(inserted))
+		for i := range inserted {
+			entries[i], err = newAuditEntry(ctx, audit.ActionGenerate, nil, &inserted[i])
+			if err != nil {
+				return err
+			}
+		}
+		return tx.RecordAudit(ctx, entries...)
+	})
+	return inserted, err
+}
 
-	var builder strings.Builder
-	builder.WriteString("voucher_code,discount_percent,expiry_date\n")
-	for _, v := range vouchers {
-		builder.WriteString(fmt.Sprintf("%s,%d,%s\n", v.VoucherCode, v.DiscountPercent, v.ExpiryDate))
+// generateFailed maps an error from generate, telling the caller how many
+// vouchers were already committed.
+func generateFailed(err error, created, requested int) *common.AppError {
+	var appErr *common.AppError
+	if errors.Is(err, errGenerateExhausted) {
+		appErr = common.NewConflictError("could not generate enough unique codes, try a longer code_length", err)
+	} else {
+		appErr = toAppError(err, "failed to generate vouchers")
 	}
-
-	return []byte(builder.String()), nil
+	if created > 0 {
+		appErr = &common.AppError{
+			StatusCode: appErr.StatusCode,
+			Message:    fmt.Sprintf("%s; %d of %d vouchers were created before the failure", appErr.Message, created, requested),
+			Err:        appErr.Err,
+		}
+	}
+	return appErr
 }
 
-func validateDate(dateStr string) error {
-	_, err := time.Parse("2006-01-02", dateStr)
-	return err
-}
+// Clone copies every attribute of a live voucher except its code into new
+// vouchers. Explicit codes are created one by one, so a taken or invalid
+// code fails on its own like a CSV row; generated codes are created in
+// batches like POST /vouchers/generate. Clones of an archived voucher start as
+// draft.
+func (s *Service) Clone(ctx context.Context, id int64, input CloneVoucherInput) (CloneResult, *common.AppError) {
+	explicit := len(input.Codes) > 0
+	if explicit == (input.Count > 0) {
+		return CloneResult{}, common.NewValidationError("provide either codes or count", nil)
+	}
+	if explicit && (input.Prefix != "" || input.CodeLength != 0 || input.Charset != "" || input.CheckDigit != nil) {
+		return CloneResult{}, common.NewValidationError("prefix, code_length, charset and check_digit only apply to generated codes", nil)
+	}
 
-func handlePgxError(err error) *common.AppError {
-	var pgErr *pgconn.PgError
-	if errors.As(err, &pgErr) {
-		switch pgErr.Code {
-		case "23505":
-			return common.NewConflictError("voucher_code already exists", err)
+	readCtx, cancel := context.WithTimeout(ctx, s.cfg.QueryTimeout)
+	source, err := s.repo.GetByID(readCtx, id)
+	cancel()
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return CloneResult{}, common.NewNotFoundError("voucher not found", err)
 		}
+		return CloneResult{}, common.NewInternalError("failed to fetch voucher", err)
 	}
-	return common.NewInternalError("database error", err)
+	if source.PersonalCustomerID != nil && (input.Count > 1 || len(input.Codes) > 1) {
+		return CloneResult{}, common.NewValidationError("a personal voucher can only be cloned into one voucher", nil)
+	}
+
+	template := Voucher{
+		DiscountType:              source.DiscountType,
+		DiscountPercent:           source.DiscountPercent,
+		DiscountAmount:            source.DiscountAmount,
+		Currency:                  source.Currency,
+		MinOrderAmount:            source.MinOrderAmount,
+		MaxDiscountAmount:         source.MaxDiscountAmount,
+		ValidFrom:                 source.ValidFrom,
+		ExpiryDate:                source.ExpiryDate,
+		Timezone:                  source.Timezone,
+		State:                     source.State,
+		CampaignID:                source.CampaignID,
+		MaxRedemptions:            source.MaxRedemptions,
+		MaxRedemptionsPerCustomer: source.MaxRedemptionsPerCustomer,
+		Stackable:                 source.Stackable,
+		ExclusivityGroup:          source.ExclusivityGroup,
+		PersonalCustomerID:        source.PersonalCustomerID,
+		AllowedCustomerIDs:        source.AllowedCustomerIDs,
+		AllowedEmailHashes:        source.AllowedEmailHashes,
+		IncludeSKUs:               source.IncludeSKUs,
+		ExcludeSKUs:               source.ExcludeSKUs,
+		IncludeCategories:         source.IncludeCategories,
+		ExcludeCategories:         source.ExcludeCategories,
+		Tags:                      source.Tags,
+	}
+	if template.State == StateArchived {
+		template.State = StateDraft
+	}
+
+	if !explicit {
+		generated, appErr := s.generate(ctx, GenerateVouchersInput{
+			Prefix:                    input.Prefix,
+			Count:                     input.Count,
+			CodeLength:                input.CodeLength,
+			Charset:                   input.Charset,
+			CheckDigit:                input.CheckDigit,
+			DiscountType:              template.DiscountType,
+			DiscountPercent:           template.DiscountPercent,
+			DiscountAmount:            template.DiscountAmount,
+			Currency:                  template.Currency,
+			MinOrderAmount:            template.MinOrderAmount,
+			MaxDiscountAmount:         template.MaxDiscountAmount,
+			ValidFrom:                 template.ValidFrom,
+			ExpiryDate:                template.ExpiryDate,
+			Timezone:                  template.Timezone,
+			State:                     template.State,
+			CampaignID:                template.CampaignID,
+			MaxRedemptions:            template.MaxRedemptions,
+			MaxRedemptionsPerCustomer: template.MaxRedemptionsPerCustomer,
+			Stackable:                 template.Stackable,
+			ExclusivityGroup:          template.ExclusivityGroup,
+			PersonalCustomerID:        template.PersonalCustomerID,
+			AllowedCustomerIDs:        template.AllowedCustomerIDs,
+			AllowedEmailHashes:        template.AllowedEmailHashes,
+			IncludeSKUs:               template.IncludeSKUs,
+			ExcludeSKUs:               template.ExcludeSKUs,
+			IncludeCategories:         template.IncludeCategories,
+			ExcludeCategories:         template.ExcludeCategories,
+			Tags:                      template.Tags,
+		})
+		if appErr != nil {
+			return CloneResult{}, appErr
+		}
+
+		result := CloneResult{TotalCodes: len(generated), SuccessCount: len(generated), Results: make([]CloneStatus, len(generated))}
+		for i, v := range generated {
+			result.Results[i] = CloneStatus{VoucherCode: v.VoucherCode, VoucherID: &v.ID}
+		}
+		return result, nil
+	}
+
+	ctx, cancel = context.WithTimeout(ctx, s.cfg.QueryTimeout*2)
+	defer cancel()
+
+	result := CloneResult{TotalCodes: len(input.Codes), Results: make([]CloneStatus, 0, len(input.Codes))}
+	seenCodes := make(map[string]struct{}, len(input.Codes))
+	for _, code := range input.Codes {
+		v := template
+		v.VoucherCode = code
+		status := CloneStatus{VoucherCode: s.codePolicy.Normalize(code)}
+
+		created, reason, appErr := s.createClone(ctx, v, seenCodes)
+		if appErr != nil {
+			return CloneResult{}, appErr
+		}
+		if reason != "" {
+			status.Reason = reason
+			result.FailureCount++
+		} else {
+			status.VoucherID = &created.ID
+			result.SuccessCount++
+		}
+		result.Results = append(result.Results, status)
+	}
+
+	return result, nil
+}
+
+// createClone creates one explicitly named clone. A code that cannot be used
+// is reported through reason; appErr is only set when the database fails.
+func (s *Service) createClone(ctx context.Context, v Voucher, seenCodes map[string]struct{}) (created Voucher, reason string, appErr *common.AppError) {
+	if strings.TrimSpace(v.VoucherCode) == "" {
+		return Voucher{}, "voucher_code required", nil
+	}
+	key := s.codePolicy.Key(v.VoucherCode)
+	if _, dup := seenCodes[key]; dup {
+		return Voucher{}, "duplicate voucher_code in request", nil
+	}
+	if appErr := s.prepareVoucher(&v); appErr != nil {
+		return Voucher{}, appErr.Message, nil
+	}
+	if appErr := s.verifyCheckDigit(ctx, v.VoucherCode); appErr != nil {
+		return Voucher{}, appErr.Message, nil
+	}
+
+	exists, err := s.repo.ExistsByCode(ctx, v.VoucherCode, nil)
+	if err != nil {
+		return Voucher{}, "", common.NewInternalError("failed to check voucher code", err)
+	}
+	if exists {
+		return Voucher{}, "voucher_code already exists", nil
+	}
+
+	err = s.repo.WithTx(ctx, func(tx *Repository) error {
+		var err error
+		created, err = tx.Create(ctx, v)
+		if err != nil {
+			return err
+		}
+		return recordAudit(ctx, tx, audit.ActionCreate, nil, &created)
+	})
+	if err != nil {
+		s.logger.Errorf("clone failed for code %q: %v", v.VoucherCode, err)
+		return Voucher{}, handlePgxError(err).Message, nil
+	}
+
+	seenCodes[key] = struct{}{}
+	return created, "", nil
+}
+
+// Transition moves a voucher to another lifecycle state. Moves not listed in
+// stateTransitions are rejected with 409.
+func (s *Service) Transition(ctx context.Context, id int64, input TransitionVoucherInput, ifMatch IfMatch) (Voucher, *common.AppError) {
+	if appErr := s.checkIfMatchPresent(ifMatch); appErr != nil {
+		return Voucher{}, appErr
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.QueryTimeout)
+	defer cancel()
+
+	var updated Voucher
+	err := s.repo.WithTx(ctx, func(tx *Repository) error {
+		current, err := tx.GetByIDForUpdate(ctx, id)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return common.NewNotFoundError("voucher not found", err)
+			}
+			return common.NewInternalError("failed to fetch voucher", err)
+		}
+		if !ifMatch.matches(current.Version) {
+			return common.NewPreconditionFailedError("voucher has been modified since it was loaded", nil)
+		}
+
+		if !canTransition(current.State, input.State) {
+			return common.NewConflictError(fmt.Sprintf("cannot transition voucher from %s to %s", current.State, input.State), nil)
+		}
+
+		updated, err = tx.UpdateState(ctx, id, input.State)
+		if err != nil {
+			return common.NewInternalError("failed to update voucher state", err)
+		}
+		return recordAudit(ctx, tx, audit.ActionUpdate, &current, &updated)
+	})
+	if err != nil {
+		return Voucher{}, toAppError(err, "failed to update voucher state")
+	}
+
+	return updated, nil
+}
+
+// Redeem applies a voucher to an order and records the redemption. The voucher
+// row stays locked for the duration of the transaction so concurrent
+// redemptions of the same code are serialized and usage limits are checked
+// against counts that cannot change until the redemption is committed.
+func (s *Service) Redeem(ctx context.Context, input RedeemVoucherInput) (Redemption, *common.AppError) {
+	code := s.codePolicy.Normalize(input.VoucherCode)
+	customer := newCustomer(input.CustomerID, input.CustomerEmail)
+	orderReference := strings.TrimSpace(input.OrderReference)
+	if orderReference == "" {
+		return Redemption{}, common.NewValidationError("order_reference is required", nil)
+	}
+	if appErr := validateCart(input.OrderAmount, input.Lines); appErr != nil {
+		return Redemption{}, appErr
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.QueryTimeout)
+	defer cancel()
+
+	if appErr := s.verifyCheckDigit(ctx, code); appErr != nil {
+		return Redemption{}, appErr
+	}
+
+	var redemption Redemption
+	err := s.repo.WithTx(ctx, func(tx *Repository) error {
+		v, discount, err := lockAndPrice(ctx, tx, code, customer, input.Currency, input.OrderAmount, input.Lines)
+		if err != nil {
+			return err
+		}
+		if appErr := checkStacking(ctx, tx, v, orderReference); appErr != nil {
+			return appErr
+		}
+
+		created, err := tx.CreateRedemption(ctx, Redemption{
+			VoucherID:      v.ID,
+			CustomerID:     customer.id,
+			OrderReference: orderReference,
+			OrderAmount:    input.OrderAmount,
+			DiscountAmount: discount,
+		})
+		if err != nil {
+			return handlePgxError(err)
+		}
+
+		created.VoucherCode = v.VoucherCode
+		created.FinalAmount = created.OrderAmount - created.DiscountAmount
+		redemption = created
+		return nil
+	})
+	if err != nil {
+		return Redemption{}, toAppError(err, "failed to redeem voucher")
+	}
+
+	return redemption, nil
+}
+
+// Reserve holds one use of the voucher for an order until the reservation is
+// confirmed, released, or its TTL runs out. The hold is subject to the same
+// checks as Redeem and counts against the usage limits while it lasts.
+func (s *Service) Reserve(ctx context.Context, code string, input ReserveVoucherInput) (Reservation, *common.AppError) {
+	code = s.codePolicy.Normalize(code)
+	customer := newCustomer(input.CustomerID, input.CustomerEmail)
+	orderReference := strings.TrimSpace(input.OrderReference)
+	if orderReference == "" {
+		return Reservation{}, common.NewValidationError("order_reference is required", nil)
+	}
+	if appErr := validateCart(input.OrderAmount, input.Lines); appErr != nil {
+		return Reservation{}, appErr
+	}
+	ttl := s.cfg.ReservationTTL
+	if input.TTLSeconds > 0 {
+		ttl = time.Duration(input.TTLSeconds) * time.Second
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.QueryTimeout)
+	defer cancel()
+
+	if appErr := s.verifyCheckDigit(ctx, code); appErr != nil {
+		return Reservation{}, appErr
+	}
+
+	var reservation Reservation
+	err := s.repo.WithTx(ctx, func(tx *Repository) error {
+		v, discount, err := lockAndPrice(ctx, tx, code, customer, input.Currency, input.OrderAmount, input.Lines)
+		if err != nil {
+			return err
+		}
+		if appErr := checkStacking(ctx, tx, v, orderReference); appErr != nil {
+			return appErr
+		}
+
+		reservation, err = tx.CreateReservation(ctx, Reservation{
+			VoucherID:      v.ID,
+			CustomerID:     customer.id,
+			OrderReference: orderReference,
+			OrderAmount:    input.OrderAmount,
+			DiscountAmount: discount,
+		}, ttl)
+		if err != nil {
+			return handlePgxError(err)
+		}
+		return nil
+	})
+	if err != nil {
+		return Reservation{}, toAppError(err, "failed to reserve voucher")
+	}
+
+	return reservation, nil
+}
+
+func (s *Service) GetReservation(ctx context.Context, id int64) (Reservation, *common.AppError) {
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.QueryTimeout)
+	defer cancel()
+
+	reservation, err := s.repo.GetReservation(ctx, id)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Reservation{}, common.NewNotFoundError("reservation not found", err)
+		}
+		return Reservation{}, common.NewInternalError("failed to fetch reservation", err)
+	}
+
+	return reservation, nil
+}
+
+// ConfirmReservation turns a held reservation into a redemption using the
+// amounts priced when the hold was taken.
+func (s *Service) ConfirmReservation(ctx context.Context, id int64) (Redemption, *common.AppError) {
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.QueryTimeout)
+	defer cancel()
+
+	var redemption Redemption
+	err := s.repo.WithTx(ctx, func(tx *Repository) error {
+		res, err := lockHeldReservation(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+
+		created, err := tx.CreateRedemption(ctx, Redemption{
+			VoucherID:      res.VoucherID,
+			CustomerID:     res.CustomerID,
+			OrderReference: res.OrderReference,
+			OrderAmount:    res.OrderAmount,
+			DiscountAmount: res.DiscountAmount,
+		})
+		if err != nil {
+			return handlePgxError(err)
+		}
+		if _, err := tx.UpdateReservationStatus(ctx, res.ID, ReservationConfirmed, &created.ID); err != nil {
+			return err
+		}
+
+		created.VoucherCode = res.VoucherCode
+		created.FinalAmount = created.OrderAmount - created.DiscountAmount
+		redemption = created
+		return nil
+	})
+	if err != nil {
+		return Redemption{}, toAppError(err, "failed to confirm reservation")
+	}
+
+	return redemption, nil
+}
+
+// ReleaseReservation gives a held use back to the voucher.
+func (s *Service) ReleaseReservation(ctx context.Context, id int64) (Reservation, *common.AppError) {
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.QueryTimeout)
+	defer cancel()
+
+	var reservation Reservation
+	err := s.repo.WithTx(ctx, func(tx *Repository) error {
+		res, err := lockHeldReservation(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		reservation, err = tx.UpdateReservationStatus(ctx, res.ID, ReservationReleased, nil)
+		return err
+	})
+	if err != nil {
+		return Reservation{}, toAppError(err, "failed to release reservation")
+	}
+
+	return reservation, nil
+}
+
+// RunReservationSweeper marks lapsed holds as expired every interval until
+// ctx is cancelled. A lapsed hold stops counting against usage limits as soon
+// as it expires; the sweeper only keeps the stored status accurate.
+func (s *Service) RunReservationSweeper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			sweepCtx, cancel := context.WithTimeout(ctx, s.cfg.QueryTimeout)
+			expired, err := s.repo.ExpireReservations(sweepCtx)
+			cancel()
+			if err != nil {
+				s.logger.Errorf("failed to expire reservations: %v", err)
+				continue
+			}
+			if expired > 0 {
+				s.logger.Infof("expired %d voucher reservations", expired)
+			}
+		}
+	}
+}
+
+func (s *Service) UploadCSV(ctx context.Context, fileHeader *multipart.FileHeader) (CSVImportResult, *common.AppError) {
+	if fileHeader.Size > s.cfg.CSVMaxSizeBytes {
+		return CSVImportResult{}, common.NewValidationError("file size exceeds limit", nil)
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		return CSVImportResult{}, common.NewValidationError("unable to open file", err)
+	}
+	defer file.Close()
+
+	content, err := io.ReadAll(io.LimitReader(file, s.cfg.CSVMaxSizeBytes+1))
+	if err != nil {
+		return CSVImportResult{}, common.NewValidationError("failed to read file", err)
+	}
+
+	reader := csv.NewReader(bytes.NewReader(bytes.TrimSpace(content)))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	headerRecord, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return CSVImportResult{}, common.NewValidationError("empty file", nil)
+		}
+		return CSVImportResult{}, common.NewValidationError("invalid CSV format", err)
+	}
+
+	header, err := parseCSVHeader(headerRecord)
+	if err != nil {
+		return CSVImportResult{}, common.NewValidationError("invalid CSV header", err)
+	}
+
+	result := CSVImportResult{}
+	seenCodes := make(map[string]struct{})
+	campaigns := make(map[int64]campaign.Campaign)
+
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.QueryTimeout*2)
+	defer cancel()
+
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		result.TotalRows++
+
+		if err != nil {
+			rowNum := result.TotalRows
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				rowNum = parseErr.StartLine - 1
+			}
+			result.FailureCount++
+			result.Failures = append(result.Failures, CSVImportStatus{Row: rowNum, Reason: "malformed row"})
+			continue
+		}
+
+		// Rows are numbered from the first line after the header.
+		line, _ := reader.FieldPos(0)
+		rowNum := line - 1
+
+		if len(record) != len(header) {
+			result.FailureCount++
+			result.Failures = append(result.Failures, CSVImportStatus{Row: rowNum, Reason: "invalid column count"})
+			continue
+		}
+
+		v, reason := header.voucher(record)
+		if reason != "" {
+			result.FailureCount++
+			result.Failures = append(result.Failures, CSVImportStatus{Row: rowNum, Reason: reason})
+			continue
+		}
+
+		if v.VoucherCode == "" {
+			result.FailureCount++
+			result.Failures = append(result.Failures, CSVImportStatus{Row: rowNum, Reason: "voucher_code required"})
+			continue
+		}
+
+		if _, exists := seenCodes[s.codePolicy.Key(v.VoucherCode)]; exists {
+			result.FailureCount++
+			result.Failures = append(result.Failures, CSVImportStatus{Row: rowNum, Reason: "duplicate voucher_code in file"})
+			continue
+		}
+
+		if appErr := s.applyCampaignDefaults(ctx, &v, campaigns); appErr != nil {
+			result.FailureCount++
+			result.Failures = append(result.Failures, CSVImportStatus{Row: rowNum, Reason: appErr.Message})
+			continue
+		}
+
+		if appErr := s.prepareVoucher(&v); appErr != nil {
+			result.FailureCount++
+			result.Failures = append(result.Failures, CSVImportStatus{Row: rowNum, Reason: appErr.Message})
+			continue
+		}
+
+		if appErr := s.verifyCheckDigit(ctx, v.VoucherCode); appErr != nil {
+			result.FailureCount++
+			result.Failures = append(result.Failures, CSVImportStatus{Row: rowNum, Reason: appErr.Message})
+			continue
+		}
+
+		exists, err := s.repo.ExistsByCode(ctx, v.VoucherCode, nil)
+		if err != nil {
+			return CSVImportResult{}, common.NewInternalError("failed to check voucher code", err)
+		}
+		if exists {
+			result.FailureCount++
+			result.Failures = append(result.Failures, CSVImportStatus{Row: rowNum, Reason: "voucher_code already exists"})
+			continue
+		}
+
+		err = s.repo.WithTx(ctx, func(tx *Repository) error {
+			created, err := tx.Create(ctx, v)
+			if err != nil {
+				return err
+			}
+			return recordAudit(ctx, tx, audit.ActionImport, nil, &created)
+		})
+		if err != nil {
+			result.FailureCount++
+			result.Failures = append(result.Failures, CSVImportStatus{Row: rowNum, Reason: "failed to insert voucher"})
+			s.logger.Errorf("csv import failed for row %d: %v", rowNum, err)
+			continue
+		}
+
+		seenCodes[s.codePolicy.Key(v.VoucherCode)] = struct{}{}
+		result.SuccessCount++
+	}
+
+	if result.Failures == nil {
+		result.Failures = make([]CSVImportStatus, 0)
+	}
+
+	return result, nil
+}
+
+func (s *Service) Export(ctx context.Context) ([]byte, *common.AppError) {
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.QueryTimeout*2)
+	defer cancel()
+
+	vouchers, err := s.repo.GetAll(ctx)
+	if err != nil {
+		return nil, common.NewInternalError("failed to export vouchers", err)
+	}
+
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	if err := writer.Write(csvColumns); err != nil {
+		return nil, common.NewInternalError("failed to export vouchers", err)
+	}
+	for _, v := range vouchers {
+		if err := writer.Write(voucherCSVRecord(v)); err != nil {
+			return nil, common.NewInternalError("failed to export vouchers", err)
+		}
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return nil, common.NewInternalError("failed to export vouchers", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// applyCampaignDefaults fills the attributes a new voucher left empty with the
+// defaults of its campaign. cache, when non-nil, avoids refetching the same
+// campaign for every row of a bulk import.
+func (s *Service) applyCampaignDefaults(ctx context.Context, v *Voucher, cache map[int64]campaign.Campaign) *common.AppError {
+	if v.CampaignID == nil {
+		return nil
+	}
+
+	c, ok := cache[*v.CampaignID]
+	if !ok {
+		fetched, appErr := s.campaigns.Get(ctx, *v.CampaignID)
+		if appErr != nil {
+			if appErr.StatusCode == http.StatusNotFound {
+				return common.NewValidationError("campaign_id does not reference an existing campaign", appErr)
+			}
+			return appErr
+		}
+		c = fetched
+		if cache != nil {
+			cache[c.ID] = c
+		}
+	}
+
+	// The discount is taken as a whole so a campaign default never ends up
+	// mixed with a partially specified voucher discount.
+	if v.DiscountType == "" && v.DiscountPercent == 0 && v.DiscountAmount == 0 && c.DiscountType != nil {
+		v.DiscountType = *c.DiscountType
+		if c.DiscountPercent != nil {
+			v.DiscountPercent = *c.DiscountPercent
+		}
+		if c.DiscountAmount != nil {
+			v.DiscountAmount = *c.DiscountAmount
+		}
+	}
+	if v.Currency == "" && c.Currency != nil {
+		v.Currency = *c.Currency
+	}
+	if v.MinOrderAmount == nil {
+		v.MinOrderAmount = c.MinOrderAmount
+	}
+	if v.MaxDiscountAmount == nil {
+		v.MaxDiscountAmount = c.MaxDiscountAmount
+	}
+	if v.ValidFrom == "" && c.ValidFrom != nil {
+		v.ValidFrom = *c.ValidFrom
+	}
+	if v.ExpiryDate == "" && c.ExpiryDate != nil {
+		v.ExpiryDate = *c.ExpiryDate
+	}
+
+	return nil
+}
+
+// prepareVoucher normalizes user supplied voucher attributes in place and
+// validates them. Every write path (API, CSV) goes through it so the rules
+// cannot drift apart.
+func (s *Service) prepareVoucher(v *Voucher) *common.AppError {
+	v.VoucherCode = s.codePolicy.Normalize(v.VoucherCode)
+	v.ValidFrom = strings.TrimSpace(v.ValidFrom)
+	if v.State == "" {
+		v.State = StateActive
+	}
+	v.ExpiryDate = strings.TrimSpace(v.ExpiryDate)
+
+	if v.ExpiryDate == "" {
+		return common.NewValidationError("expiry_date is required", nil)
+	}
+	if err := validateDate(v.ExpiryDate); err != nil {
+		return common.NewValidationError("expiry_date must be in YYYY-MM-DD format", err)
+	}
+	// An empty valid_from means "today" on create and "unchanged" on update;
+	// the database enforces the window in both cases.
+	if v.ValidFrom != "" {
+		if err := validateDate(v.ValidFrom); err != nil {
+			return common.NewValidationError("valid_from must be in YYYY-MM-DD format", err)
+		}
+		if v.ValidFrom > v.ExpiryDate {
+			return common.NewValidationError("valid_from must not be after expiry_date", nil)
+		}
+	}
+	if v.Timezone != nil {
+		zone, err := normalizeTimezone(*v.Timezone)
+		if err != nil {
+			return common.NewValidationError(err.Error(), nil)
+		}
+		v.Timezone = zone
+	}
+	if appErr := s.validateDiscount(v); appErr != nil {
+		return appErr
+	}
+	if v.ExclusivityGroup != nil {
+		group, err := normalizeExclusivityGroup(*v.ExclusivityGroup)
+		if err != nil {
+			return common.NewValidationError(err.Error(), nil)
+		}
+		v.ExclusivityGroup = group
+	}
+	if v.Tags != nil {
+		tags, err := normalizeTags(v.Tags)
+		if err != nil {
+			return common.NewValidationError(err.Error(), nil)
+		}
+		v.Tags = tags
+	}
+	if appErr := normalizeScopes(v); appErr != nil {
+		return appErr
+	}
+	if appErr := normalizeCustomers(v); appErr != nil {
+		return appErr
+	}
+	return validateLimits(v.MaxRedemptions, v.MaxRedemptionsPerCustomer)
+}
+
+func (s *Service) validateDiscount(v *Voucher) *common.AppError {
+	v.DiscountType = strings.ToLower(strings.TrimSpace(v.DiscountType))
+	if v.DiscountType == "" {
+		v.DiscountType = DiscountTypePercent
+	}
+
+	v.Currency = strings.ToUpper(strings.TrimSpace(v.Currency))
+	if v.Currency == "" {
+		v.Currency = s.cfg.DefaultCurrency
+	}
+	if !isCurrencyCode(v.Currency) {
+		return common.NewValidationError("currency must be a 3-letter ISO 4217 code", nil)
+	}
+
+	switch v.DiscountType {
+	case DiscountTypePercent:
+		if v.DiscountPercent < 1 || v.DiscountPercent > 100 {
+			return common.NewValidationError("discount_percent must be between 1 and 100", nil)
+		}
+		if v.DiscountAmount != 0 {
+			return common.NewValidationError("discount_amount is only allowed for fixed_amount vouchers", nil)
+		}
+	case DiscountTypeFixedAmount:
+		if v.DiscountAmount < 1 {
+			return common.NewValidationError("discount_amount must be greater than 0", nil)
+		}
+		if v.DiscountPercent != 0 {
+			return common.NewValidationError("discount_percent is only allowed for percent vouchers", nil)
+		}
+	default:
+		return common.NewValidationError("discount_type must be percent or fixed_amount", nil)
+	}
+
+	if v.MinOrderAmount != nil && *v.MinOrderAmount < 1 {
+		return common.NewValidationError("min_order_amount must be greater than 0", nil)
+	}
+	if v.MaxDiscountAmount != nil && *v.MaxDiscountAmount < 1 {
+		return common.NewValidationError("max_discount_amount must be greater than 0", nil)
+	}
+	if v.DiscountType == DiscountTypeFixedAmount && v.MaxDiscountAmount != nil && *v.MaxDiscountAmount < v.DiscountAmount {
+		return common.NewValidationError("max_discount_amount cannot be lower than discount_amount", nil)
+	}
+
+	return nil
+}
+
+// normalizeTags lowercases, trims and de-duplicates tags and returns them
+// sorted. Tags are limited to letters, digits, '-' and '_' so they stay
+// safe to use in query strings and the CSV tags column.
+func normalizeTags(raw []string) ([]string, error) {
+	seen := make(map[string]struct{}, len(raw))
+	tags := make([]string, 0, len(raw))
+	for _, tag := range raw {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" {
+			continue
+		}
+		if len(tag) > maxTagLength {
+			return nil, fmt.Errorf("tag %q must be at most %d characters", tag, maxTagLength)
+		}
+		for _, r := range tag {
+			if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '-' && r != '_' {
+				return nil, fmt.Errorf("tag %q may only contain letters, digits, '-' and '_'", tag)
+			}
+		}
+		if _, ok := seen[tag]; ok {
+			continue
+		}
+		seen[tag] = struct{}{}
+		tags = append(tags, tag)
+	}
+	if len(tags) > maxTagsPerVoucher {
+		return nil, fmt.Errorf("a voucher can have at most %d tags", maxTagsPerVoucher)
+	}
+	sort.Strings(tags)
+	return tags, nil
+}
+
+// normalizeExclusivityGroup applies the tag naming rules to an exclusivity
+// group. A blank group means none.
+func normalizeExclusivityGroup(raw string) (*string, error) {
+	group := strings.ToLower(strings.TrimSpace(raw))
+	if group == "" {
+		return nil, nil
+	}
+	if len(group) > maxTagLength {
+		return nil, fmt.Errorf("exclusivity_group must be at most %d characters", maxTagLength)
+	}
+	for _, r := range group {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '-' && r != '_' {
+			return nil, errors.New("exclusivity_group may only contain letters, digits, '-' and '_'")
+		}
+	}
+	return &group, nil
+}
+
+// normalizeTimezone checks that raw names an IANA time zone. A blank zone
+// means the business time zone.
+func normalizeTimezone(raw string) (*string, error) {
+	zone := strings.TrimSpace(raw)
+	if zone == "" {
+		return nil, nil
+	}
+	if len(zone) > maxTimezoneLength || zone == "Local" {
+		return nil, errors.New("timezone must be an IANA time zone name such as Asia/Jakarta")
+	}
+	if _, err := time.LoadLocation(zone); err != nil {
+		return nil, errors.New("timezone must be an IANA time zone name such as Asia/Jakarta")
+	}
+	return &zone, nil
+}
+
+func isCurrencyCode(code string) bool {
+	if len(code) != 3 {
+		return false
+	}
+	for _, r := range code {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+func validateDate(dateStr string) error {
+	_, err := time.Parse("2006-01-02", dateStr)
+	return err
+}
+
+func validateLimits(maxRedemptions, maxPerCustomer *int) *common.AppError {
+	if maxRedemptions != nil && *maxRedemptions < 1 {
+		return common.NewValidationError("max_redemptions must be at least 1", nil)
+	}
+	if maxPerCustomer != nil && *maxPerCustomer < 1 {
+		return common.NewValidationError("max_redemptions_per_customer must be at least 1", nil)
+	}
+	if maxRedemptions != nil && maxPerCustomer != nil && *maxPerCustomer > *maxRedemptions {
+		return common.NewValidationError("max_redemptions_per_customer cannot exceed max_redemptions", nil)
+	}
+	return nil
+}
+
+// checkIfMatchPresent enforces REQUIRE_IF_MATCH for writes to an existing
+// voucher.
+func (s *Service) checkIfMatchPresent(ifMatch IfMatch) *common.AppError {
+	if s.cfg.RequireIfMatch && !ifMatch.Present {
+		return common.NewPreconditionRequiredError("If-Match header is required", nil)
+	}
+	return nil
+}
+
+// notFoundOrPreconditionFailed explains a conditional write that matched no
+// row: either the voucher is gone or someone else changed it first.
+func (s *Service) notFoundOrPreconditionFailed(ctx context.Context, id int64, ifMatch IfMatch, err error) *common.AppError {
+	if ifMatch.versions() != nil {
+		if _, getErr := s.repo.GetByID(ctx, id); getErr == nil {
+			return common.NewPreconditionFailedError("voucher has been modified since it was loaded", err)
+		}
+	}
+	return common.NewNotFoundError("voucher not found", err)
+}
+
+// lockAndPrice locks the voucher with the given code, checks that it can be
+// used for the order and returns the discount it gives. It must run inside a
+// transaction so the lock covers the write that consumes the use.
+func lockAndPrice(ctx context.Context, tx *Repository, code string, c orderCustomer, currency string, orderAmount int64, lines []CartLine) (Voucher, int64, error) {
+	v, err := tx.GetByCodeForUpdate(ctx, code)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Voucher{}, 0, common.NewNotFoundError("voucher not found", err)
+		}
+		return Voucher{}, 0, common.NewInternalError("failed to fetch voucher", err)
+	}
+
+	discount, appErr := priceVoucher(ctx, tx, v, c, currency, orderAmount, lines)
+	if appErr != nil {
+		return Voucher{}, 0, appErr
+	}
+	return v, discount, nil
+}
+
+// priceVoucher checks that v can be used on an order and returns the
+// discount it gives. A voucher scoped to some products needs the cart lines
+// and only discounts the eligible ones.
+func priceVoucher(ctx context.Context, repo *Repository, v Voucher, c orderCustomer, currency string, orderAmount int64, lines []CartLine) (int64, *common.AppError) {
+	if appErr := checkUsable(ctx, repo, v, c, currency); appErr != nil {
+		return 0, appErr
+	}
+
+	if !v.scoped() {
+		return calculateDiscount(v, orderAmount)
+	}
+	if len(lines) == 0 {
+		return 0, common.NewValidationError("lines are required because this voucher only applies to some products", nil)
+	}
+	_, discount, appErr := priceLines(v, lines)
+	return discount, appErr
+}
+
+// checkUsable checks that v can be used by c in currency. The usage limit
+// check is only authoritative when v is locked, see checkUsageLimits.
+func checkUsable(ctx context.Context, repo *Repository, v Voucher, c orderCustomer, currency string) *common.AppError {
+	if appErr := checkRedeemable(v); appErr != nil {
+		return appErr
+	}
+
+	if currency != "" && !strings.EqualFold(currency, v.Currency) {
+		return common.NewUnprocessableError("order currency does not match voucher currency", nil)
+	}
+
+	if appErr := checkCustomer(v, c); appErr != nil {
+		return appErr
+	}
+
+	return checkUsageLimits(ctx, repo, v, c.id)
+}
+
+// lockHeldReservation locks a reservation together with its voucher, in the
+// same voucher-first order Reserve uses, and checks that it is still held.
+func lockHeldReservation(ctx context.Context, tx *Repository, id int64) (Reservation, error) {
+	res, err := tx.GetReservation(ctx, id)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Reservation{}, common.NewNotFoundError("reservation not found", err)
+		}
+		return Reservation{}, common.NewInternalError("failed to fetch reservation", err)
+	}
+	if _, err := tx.GetByIDForUpdate(ctx, res.VoucherID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Reservation{}, common.NewNotFoundError("voucher not found", err)
+		}
+		return Reservation{}, common.NewInternalError("failed to fetch voucher", err)
+	}
+	res, err = tx.GetReservationForUpdate(ctx, id)
+	if err != nil {
+		return Reservation{}, common.NewInternalError("failed to fetch reservation", err)
+	}
+	if res.Status != ReservationHeld {
+		return Reservation{}, common.NewConflictError(fmt.Sprintf("reservation is %s", res.Status), nil)
+	}
+	return res, nil
+}
+
+// checkUsageLimits must run inside the transaction holding the voucher row
+// lock; otherwise two redemptions could both observe the last free use.
+func checkUsageLimits(ctx context.Context, tx *Repository, v Voucher, customerID string) *common.AppError {
+	if v.MaxRedemptionsPerCustomer != nil && customerID == "" {
+		return common.NewValidationError("customer_id is required for this voucher", nil)
+	}
+	if v.MaxRedemptions == nil && v.MaxRedemptionsPerCustomer == nil {
+		return nil
+	}
+
+	total, byCustomer, err := tx.CountUses(ctx, v.ID, customerID)
+	if err != nil {
+		return common.NewInternalError("failed to count voucher redemptions", err)
+	}
+	if v.MaxRedemptions != nil && total >= *v.MaxRedemptions {
+		return common.NewUnprocessableError("voucher redemption limit reached", nil)
+	}
+	if v.MaxRedemptionsPerCustomer != nil && byCustomer >= *v.MaxRedemptionsPerCustomer {
+		return common.NewUnprocessableError("customer redemption limit reached for this voucher", nil)
+	}
+	return nil
+}
+
+func canTransition(from, to string) bool {
+	for _, allowed := range stateTransitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+func checkRedeemable(v Voucher) *common.AppError {
+	if v.State != StateActive {
+		return common.NewUnprocessableError(fmt.Sprintf("voucher is %s", v.State), nil)
+	}
+
+	switch v.Status {
+	case StatusScheduled:
+		return common.NewUnprocessableError("voucher is not valid yet", nil)
+	case StatusExpired:
+		return common.NewUnprocessableError("voucher has expired", nil)
+	}
+	return nil
+}
+
+// calculateDiscount returns the discount, in the same minor unit as
+// orderAmount, that voucher v grants on an order of that size. Orders below
+// the voucher minimum are rejected; otherwise the result is capped by
+// max_discount_amount and never exceeds the order amount.
+func calculateDiscount(v Voucher, orderAmount int64) (int64, *common.AppError) {
+	if v.MinOrderAmount != nil && orderAmount < *v.MinOrderAmount {
+		return 0, common.NewUnprocessableError("order amount is below the voucher minimum order amount", nil)
+	}
+
+	var discount int64
+	switch v.DiscountType {
+	case DiscountTypeFixedAmount:
+		discount = v.DiscountAmount
+	default:
+		discount, _ = mulDiv(orderAmount, int64(v.DiscountPercent), 100)
+	}
+
+	if v.MaxDiscountAmount != nil {
+		discount = min(discount, *v.MaxDiscountAmount)
+	}
+	return min(discount, orderAmount), nil
+}
+
+func handlePgxError(err error) *common.AppError {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case "23505":
+			if pgErr.ConstraintName == "ux_voucher_redemptions_voucher_order" {
+				return common.NewConflictError("order_reference has already redeemed this voucher", err)
+			}
+			if pgErr.ConstraintName == "ux_voucher_reservations_voucher_order_held" {
+				return common.NewConflictError("order_reference already holds a reservation for this voucher", err)
+			}
+			return common.NewConflictError("voucher_code already exists", err)
+		case "23514":
+			if pgErr.ConstraintName == "chk_vouchers_validity_window" {
+				return common.NewValidationError("valid_from must not be after expiry_date", err)
+			}
+		case "23503":
+			if pgErr.ConstraintName == "fk_vouchers_campaign" {
+				return common.NewValidationError("campaign_id does not reference an existing campaign", err)
+			}
+		}
+	}
+	return common.NewInternalError("database error", err)
+}
+
+// toAppError unwraps an *common.AppError returned from inside a transaction,
+// falling back to an internal error for anything else (e.g. a failed commit).
+func toAppError(err error, message string) *common.AppError {
+	var appErr *common.AppError
+	if errors.As(err, &appErr) {
+		return appErr
+	}
+	return common.NewInternalError(message, err)
 }
@@ -0,0 +1,209 @@
+package voucher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/mhakimsaputra17/discount-voucher-management/backend/internal/common"
+)
+
+// maxEvaluateCodes bounds the codes accepted by Evaluate; every combination
+// of them is tried.
+const maxEvaluateCodes = 10
+
+type EvaluateVouchersInput struct {
+	Codes         []string   `json:"codes" binding:"required,min=1,max=10"`
+	CustomerID    string     `json:"customer_id"`
+	CustomerEmail string     `json:"customer_email" binding:"omitempty,email"`
+	OrderAmount   int64      `json:"order_amount" binding:"required,min=1"`
+	Currency      string     `json:"currency" binding:"omitempty,len=3"`
+	Lines         []CartLine `json:"lines" binding:"omitempty,max=500,dive"`
+}
+
+type AppliedVoucher struct {
+	VoucherCode    string `json:"voucher_code"`
+	DiscountAmount int64  `json:"discount_amount"`
+}
+
+type RejectedVoucher struct {
+	VoucherCode string `json:"voucher_code"`
+	Reason      string `json:"reason"`
+}
+
+// Evaluation is the best allowed combination of the submitted codes. Every
+// submitted code appears in either Applied or Rejected.
+type Evaluation struct {
+	OrderAmount   int64             `json:"order_amount"`
+	TotalDiscount int64             `json:"total_discount"`
+	FinalAmount   int64             `json:"final_amount"`
+	Applied       []AppliedVoucher  `json:"applied"`
+	Rejected      []RejectedVoucher `json:"rejected"`
+}
+
+// stackingConflict explains why a and b cannot be used on the same order, or
+// returns "" when they can.
+func stackingConflict(a, b Voucher) string {
+	switch {
+	case !a.Stackable:
+		return fmt.Sprintf("%s cannot be combined with other vouchers", a.VoucherCode)
+	case !b.Stackable:
+		return fmt.Sprintf("%s cannot be combined with other vouchers", b.VoucherCode)
+	case a.ExclusivityGroup != nil && b.ExclusivityGroup != nil && *a.ExclusivityGroup == *b.ExclusivityGroup:
+		return fmt.Sprintf("%s and %s are both in exclusivity group %s", a.VoucherCode, b.VoucherCode, *a.ExclusivityGroup)
+	}
+	return ""
+}
+
+// checkStacking rejects using v on an order whose other redeemed or held
+// vouchers it cannot be combined with. The order stays locked until the
+// transaction ends so two vouchers cannot slip onto it concurrently.
+func checkStacking(ctx context.Context, tx *Repository, v Voucher, orderReference string) *common.AppError {
+	if err := tx.LockOrder(ctx, orderReference); err != nil {
+		return common.NewInternalError("failed to lock order", err)
+	}
+
+	others, err := tx.ListOrderVouchers(ctx, orderReference, v.ID)
+	if err != nil {
+		return common.NewInternalError("failed to load vouchers used on order", err)
+	}
+	for _, other := range others {
+		if reason := stackingConflict(v, other); reason != "" {
+			return common.NewUnprocessableError(reason, nil)
+		}
+	}
+	return nil
+}
+
+// Evaluate works out which of the submitted codes may be used together on an
+// order and picks the allowed combination with the largest discount. Each
+// voucher's discount is computed on the full order amount, or on its
+// eligible cart lines when it is scoped, and the total is capped at the
+// order amount. Nothing is redeemed or reserved.
+func (s *Service) Evaluate(ctx context.Context, input EvaluateVouchersInput) (Evaluation, *common.AppError) {
+	if len(input.Codes) > maxEvaluateCodes {
+		return Evaluation{}, common.NewValidationError(fmt.Sprintf("at most %d codes can be evaluated at once", maxEvaluateCodes), nil)
+	}
+	customer := newCustomer(input.CustomerID, input.CustomerEmail)
+	if appErr := validateCart(input.OrderAmount, input.Lines); appErr != nil {
+		return Evaluation{}, appErr
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.QueryTimeout)
+	defer cancel()
+
+	result := Evaluation{
+		OrderAmount: input.OrderAmount,
+		Applied:     make([]AppliedVoucher, 0, len(input.Codes)),
+		Rejected:    make([]RejectedVoucher, 0),
+	}
+
+	var (
+		candidates []Voucher
+		discounts  []int64
+	)
+	seenCodes := make(map[string]struct{}, len(input.Codes))
+	for _, raw := range input.Codes {
+		code := s.codePolicy.Normalize(raw)
+		if _, dup := seenCodes[s.codePolicy.Key(code)]; dup {
+			result.Rejected = append(result.Rejected, RejectedVoucher{VoucherCode: code, Reason: "duplicate code"})
+			continue
+		}
+		seenCodes[s.codePolicy.Key(code)] = struct{}{}
+
+		v, discount, appErr := s.priceForEvaluation(ctx, code, customer, input.Currency, input.OrderAmount, input.Lines)
+		if appErr != nil {
+			if appErr.StatusCode >= http.StatusInternalServerError {
+				return Evaluation{}, appErr
+			}
+			result.Rejected = append(result.Rejected, RejectedVoucher{VoucherCode: code, Reason: appErr.Message})
+			continue
+		}
+		candidates = append(candidates, v)
+		discounts = append(discounts, discount)
+	}
+
+	best := bestCombination(candidates, discounts, input.OrderAmount)
+
+	remaining := input.OrderAmount
+	for i, v := range candidates {
+		if best&(1<<i) != 0 {
+			discount := min(discounts[i], remaining)
+			remaining -= discount
+			result.Applied = append(result.Applied, AppliedVoucher{VoucherCode: v.VoucherCode, DiscountAmount: discount})
+			continue
+		}
+
+		reason := "does not increase the discount of the chosen combination"
+		for j, chosen := range candidates {
+			if best&(1<<j) == 0 {
+				continue
+			}
+			if conflict := stackingConflict(v, chosen); conflict != "" {
+				reason = conflict
+				break
+			}
+		}
+		result.Rejected = append(result.Rejected, RejectedVoucher{VoucherCode: v.VoucherCode, Reason: reason})
+	}
+
+	result.TotalDiscount = input.OrderAmount - remaining
+	result.FinalAmount = remaining
+	return result, nil
+}
+
+// priceForEvaluation runs the checks Redeem would run, without locking.
+func (s *Service) priceForEvaluation(ctx context.Context, code string, c orderCustomer, currency string, orderAmount int64, lines []CartLine) (Voucher, int64, *common.AppError) {
+	if appErr := s.verifyCheckDigit(ctx, code); appErr != nil {
+		return Voucher{}, 0, appErr
+	}
+
+	v, err := s.repo.GetByCode(ctx, code)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Voucher{}, 0, common.NewNotFoundError("voucher not found", err)
+		}
+		return Voucher{}, 0, common.NewInternalError("failed to fetch voucher", err)
+	}
+	discount, appErr := priceVoucher(ctx, s.repo, v, c, currency, orderAmount, lines)
+	if appErr != nil {
+		return Voucher{}, 0, appErr
+	}
+	return v, discount, nil
+}
+
+// bestCombination returns, as a bit set over candidates, the allowed
+// combination with the largest capped total discount. Ties go to the
+// combination with fewer vouchers.
+func bestCombination(candidates []Voucher, discounts []int64, orderAmount int64) int {
+	best, bestTotal, bestSize := 0, int64(-1), 0
+	for set := 1; set < 1<<len(candidates); set++ {
+		var (
+			total int64
+			size  int
+		)
+		allowed := true
+		for i := range candidates {
+			if set&(1<<i) == 0 {
+				continue
+			}
+			for j := i + 1; j < len(candidates) && allowed; j++ {
+				if set&(1<<j) != 0 && stackingConflict(candidates[i], candidates[j]) != "" {
+					allowed = false
+				}
+			}
+			total += discounts[i]
+			size++
+		}
+		if !allowed {
+			continue
+		}
+		total = min(total, orderAmount)
+		if total > bestTotal || (total == bestTotal && size < bestSize) {
+			best, bestTotal, bestSize = set, total, size
+		}
+	}
+	return best
+}
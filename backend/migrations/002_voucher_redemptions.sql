@@ -0,0 +1,15 @@
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS voucher_redemptions (
+    id BIGSERIAL PRIMARY KEY,
+    voucher_id BIGINT NOT NULL REFERENCES vouchers (id),
+    order_reference TEXT NOT NULL,
+    order_amount BIGINT NOT NULL CHECK (order_amount > 0),
+    discount_amount BIGINT NOT NULL CHECK (discount_amount >= 0),
+    redeemed_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS ux_voucher_redemptions_voucher_order ON voucher_redemptions (voucher_id, order_reference);
+CREATE INDEX IF NOT EXISTS idx_voucher_redemptions_redeemed_at ON voucher_redemptions (redeemed_at);
+
+COMMIT;
@@ -0,0 +1,12 @@
+BEGIN;
+
+ALTER TABLE vouchers
+    ADD COLUMN IF NOT EXISTS max_redemptions INTEGER CHECK (max_redemptions > 0),
+    ADD COLUMN IF NOT EXISTS max_redemptions_per_customer INTEGER CHECK (max_redemptions_per_customer > 0);
+
+ALTER TABLE voucher_redemptions
+    ADD COLUMN IF NOT EXISTS customer_id TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_voucher_redemptions_voucher_customer ON voucher_redemptions (voucher_id, customer_id);
+
+COMMIT;
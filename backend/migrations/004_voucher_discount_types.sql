@@ -0,0 +1,23 @@
+BEGIN;
+
+ALTER TABLE vouchers
+    ADD COLUMN IF NOT EXISTS discount_type TEXT NOT NULL DEFAULT 'percent',
+    ADD COLUMN IF NOT EXISTS discount_amount BIGINT,
+    ADD COLUMN IF NOT EXISTS currency TEXT NOT NULL DEFAULT 'IDR';
+
+-- discount_percent is only set for percent vouchers from now on; the original
+-- BETWEEN 1 AND 100 check still applies whenever it is present.
+ALTER TABLE vouchers ALTER COLUMN discount_percent DROP NOT NULL;
+
+ALTER TABLE vouchers DROP CONSTRAINT IF EXISTS chk_vouchers_discount_type;
+ALTER TABLE vouchers ADD CONSTRAINT chk_vouchers_discount_type CHECK (
+    (discount_type = 'percent' AND discount_percent IS NOT NULL AND discount_amount IS NULL)
+    OR (discount_type = 'fixed_amount' AND discount_amount > 0 AND discount_percent IS NULL)
+);
+
+ALTER TABLE vouchers DROP CONSTRAINT IF EXISTS chk_vouchers_currency;
+ALTER TABLE vouchers ADD CONSTRAINT chk_vouchers_currency CHECK (currency ~ '^[A-Z]{3}$');
+
+CREATE INDEX IF NOT EXISTS idx_vouchers_discount_amount ON vouchers (discount_amount);
+
+COMMIT;
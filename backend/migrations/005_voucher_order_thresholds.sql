@@ -0,0 +1,7 @@
+BEGIN;
+
+ALTER TABLE vouchers
+    ADD COLUMN IF NOT EXISTS min_order_amount BIGINT CHECK (min_order_amount > 0),
+    ADD COLUMN IF NOT EXISTS max_discount_amount BIGINT CHECK (max_discount_amount > 0);
+
+COMMIT;
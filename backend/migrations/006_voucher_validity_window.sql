@@ -0,0 +1,19 @@
+BEGIN;
+
+ALTER TABLE vouchers ADD COLUMN IF NOT EXISTS valid_from DATE;
+
+-- Existing vouchers were live from the moment they were created.
+UPDATE vouchers
+SET valid_from = LEAST(created_at::DATE, expiry_date)
+WHERE valid_from IS NULL;
+
+ALTER TABLE vouchers
+    ALTER COLUMN valid_from SET DEFAULT CURRENT_DATE,
+    ALTER COLUMN valid_from SET NOT NULL;
+
+ALTER TABLE vouchers DROP CONSTRAINT IF EXISTS chk_vouchers_validity_window;
+ALTER TABLE vouchers ADD CONSTRAINT chk_vouchers_validity_window CHECK (valid_from <= expiry_date);
+
+CREATE INDEX IF NOT EXISTS idx_vouchers_valid_from ON vouchers (valid_from);
+
+COMMIT;
@@ -0,0 +1,10 @@
+BEGIN;
+
+ALTER TABLE vouchers ADD COLUMN IF NOT EXISTS state TEXT NOT NULL DEFAULT 'active';
+
+ALTER TABLE vouchers DROP CONSTRAINT IF EXISTS chk_vouchers_state;
+ALTER TABLE vouchers ADD CONSTRAINT chk_vouchers_state CHECK (state IN ('draft', 'active', 'paused', 'archived'));
+
+CREATE INDEX IF NOT EXISTS idx_vouchers_state ON vouchers (state);
+
+COMMIT;
@@ -0,0 +1,12 @@
+BEGIN;
+
+ALTER TABLE vouchers ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+
+-- Codes only need to be unique among live vouchers; a trashed voucher must not
+-- block reusing its code, and restoring it re-checks uniqueness.
+DROP INDEX IF EXISTS ux_vouchers_voucher_code;
+CREATE UNIQUE INDEX IF NOT EXISTS ux_vouchers_voucher_code ON vouchers (voucher_code) WHERE deleted_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_vouchers_deleted_at ON vouchers (deleted_at) WHERE deleted_at IS NOT NULL;
+
+COMMIT;
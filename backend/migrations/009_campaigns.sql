@@ -0,0 +1,38 @@
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS campaigns (
+    id BIGSERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    discount_type TEXT CHECK (discount_type IN ('percent', 'fixed_amount')),
+    discount_percent INTEGER CHECK (discount_percent BETWEEN 1 AND 100),
+    discount_amount BIGINT CHECK (discount_amount > 0),
+    currency TEXT CHECK (currency ~ '^[A-Z]{3}$'),
+    min_order_amount BIGINT CHECK (min_order_amount > 0),
+    max_discount_amount BIGINT CHECK (max_discount_amount > 0),
+    valid_from DATE,
+    expiry_date DATE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT chk_campaigns_discount CHECK (
+        (discount_type IS NULL AND discount_percent IS NULL AND discount_amount IS NULL)
+        OR (discount_type = 'percent' AND discount_percent IS NOT NULL AND discount_amount IS NULL)
+        OR (discount_type = 'fixed_amount' AND discount_amount IS NOT NULL AND discount_percent IS NULL)
+    ),
+    CONSTRAINT chk_campaigns_validity_window CHECK (valid_from IS NULL OR expiry_date IS NULL OR valid_from <= expiry_date)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS ux_campaigns_name ON campaigns (name);
+
+DROP TRIGGER IF EXISTS trg_campaigns_set_updated_at ON campaigns;
+CREATE TRIGGER trg_campaigns_set_updated_at
+BEFORE UPDATE ON campaigns
+FOR EACH ROW
+EXECUTE FUNCTION set_updated_at();
+
+ALTER TABLE vouchers
+    ADD COLUMN IF NOT EXISTS campaign_id BIGINT CONSTRAINT fk_vouchers_campaign REFERENCES campaigns (id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_vouchers_campaign_id ON vouchers (campaign_id);
+
+COMMIT;
@@ -0,0 +1,19 @@
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS tags (
+    id BIGSERIAL PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS voucher_tags (
+    voucher_id BIGINT NOT NULL REFERENCES vouchers(id) ON DELETE CASCADE,
+    tag_id BIGINT NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+    PRIMARY KEY (voucher_id, tag_id)
+);
+
+-- The primary key covers lookups by voucher; filtering by tag needs the
+-- reverse direction.
+CREATE INDEX IF NOT EXISTS idx_voucher_tags_tag_id ON voucher_tags (tag_id);
+
+COMMIT;
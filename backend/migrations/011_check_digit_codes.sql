@@ -0,0 +1,15 @@
+BEGIN;
+
+ALTER TABLE campaigns
+    ADD COLUMN IF NOT EXISTS check_digit BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Every voucher code starting with a registered prefix must end with a Luhn
+-- mod N check character computed over the rest of the code with the given
+-- charset. Rows are only ever added, by bulk generation.
+CREATE TABLE IF NOT EXISTS check_digit_prefixes (
+    prefix TEXT PRIMARY KEY CHECK (prefix <> ''),
+    charset TEXT NOT NULL CHECK (charset IN ('alphanumeric', 'letters', 'digits')),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+COMMIT;
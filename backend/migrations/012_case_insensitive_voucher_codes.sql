@@ -0,0 +1,37 @@
+BEGIN;
+
+-- Voucher codes become unique regardless of case and surrounding whitespace.
+-- Live vouchers that would collide under that rule must be renamed or
+-- trashed by hand first; the migration aborts and lists them instead of
+-- picking a winner.
+DO $$
+DECLARE
+    conflicts TEXT;
+BEGIN
+    SELECT string_agg(format('%s: %s', normalized, codes), E'\n' ORDER BY normalized)
+    INTO conflicts
+    FROM (
+        SELECT
+            UPPER(TRIM(voucher_code)) AS normalized,
+            string_agg(format('%L (id %s)', voucher_code, id), ', ' ORDER BY id) AS codes
+        FROM vouchers
+        WHERE deleted_at IS NULL
+        GROUP BY UPPER(TRIM(voucher_code))
+        HAVING COUNT(*) > 1
+    ) c;
+
+    IF conflicts IS NOT NULL THEN
+        RAISE EXCEPTION 'voucher codes conflict case-insensitively, resolve them before migrating'
+            USING DETAIL = conflicts;
+    END IF;
+END
+$$;
+
+UPDATE vouchers
+SET voucher_code = TRIM(voucher_code)
+WHERE voucher_code <> TRIM(voucher_code);
+
+DROP INDEX IF EXISTS ux_vouchers_voucher_code;
+CREATE UNIQUE INDEX IF NOT EXISTS ux_vouchers_voucher_code_ci ON vouchers (UPPER(voucher_code)) WHERE deleted_at IS NULL;
+
+COMMIT;
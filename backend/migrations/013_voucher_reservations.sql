@@ -0,0 +1,28 @@
+BEGIN;
+
+-- A reservation holds one use of a voucher while a checkout is in flight.
+-- Held reservations count against the voucher's usage limits until they are
+-- confirmed (turned into a redemption), released, or expire.
+CREATE TABLE IF NOT EXISTS voucher_reservations (
+    id BIGSERIAL PRIMARY KEY,
+    voucher_id BIGINT NOT NULL REFERENCES vouchers (id),
+    customer_id TEXT,
+    order_reference TEXT NOT NULL,
+    order_amount BIGINT NOT NULL CHECK (order_amount > 0),
+    discount_amount BIGINT NOT NULL CHECK (discount_amount >= 0),
+    status TEXT NOT NULL DEFAULT 'held',
+    expires_at TIMESTAMPTZ NOT NULL,
+    redemption_id BIGINT REFERENCES voucher_redemptions (id),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT chk_voucher_reservations_status CHECK (status IN ('held', 'confirmed', 'released', 'expired')),
+    CONSTRAINT chk_voucher_reservations_redemption CHECK ((status = 'confirmed') = (redemption_id IS NOT NULL))
+);
+
+-- One open hold per order and voucher.
+CREATE UNIQUE INDEX IF NOT EXISTS ux_voucher_reservations_voucher_order_held
+    ON voucher_reservations (voucher_id, order_reference) WHERE status = 'held';
+CREATE INDEX IF NOT EXISTS idx_voucher_reservations_held_expires_at
+    ON voucher_reservations (expires_at) WHERE status = 'held';
+
+COMMIT;
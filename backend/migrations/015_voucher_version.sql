@@ -0,0 +1,21 @@
+BEGIN;
+
+-- version is the voucher's ETag. It is bumped on every update by a trigger so
+-- no write path can forget it.
+ALTER TABLE vouchers ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
+
+CREATE OR REPLACE FUNCTION bump_version()
+RETURNS TRIGGER AS $$
+BEGIN
+    NEW.version = OLD.version + 1;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_vouchers_bump_version ON vouchers;
+CREATE TRIGGER trg_vouchers_bump_version
+BEFORE UPDATE ON vouchers
+FOR EACH ROW
+EXECUTE FUNCTION bump_version();
+
+COMMIT;
@@ -0,0 +1,33 @@
+BEGIN;
+
+-- voucher_audit is append-only. voucher_id deliberately has no foreign key so
+-- the history of a voucher survives a purge.
+CREATE TABLE IF NOT EXISTS voucher_audit (
+    id BIGSERIAL PRIMARY KEY,
+    voucher_id BIGINT NOT NULL,
+    action VARCHAR(20) NOT NULL,
+    actor VARCHAR(255) NOT NULL,
+    request_id VARCHAR(128),
+    changes JSONB NOT NULL DEFAULT '{}'::JSONB,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT chk_voucher_audit_action CHECK (action IN ('create', 'update', 'delete', 'restore', 'purge', 'import', 'generate'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_voucher_audit_voucher_id ON voucher_audit (voucher_id, id);
+CREATE INDEX IF NOT EXISTS idx_voucher_audit_created_at ON voucher_audit (created_at);
+CREATE INDEX IF NOT EXISTS idx_voucher_audit_actor ON voucher_audit (actor, created_at);
+
+CREATE OR REPLACE FUNCTION reject_voucher_audit_change()
+RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION 'voucher_audit is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_voucher_audit_append_only ON voucher_audit;
+CREATE TRIGGER trg_voucher_audit_append_only
+BEFORE UPDATE OR DELETE ON voucher_audit
+FOR EACH ROW
+EXECUTE FUNCTION reject_voucher_audit_change();
+
+COMMIT;
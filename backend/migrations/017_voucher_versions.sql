@@ -0,0 +1,14 @@
+BEGIN;
+
+-- Snapshot of every version of a voucher that was replaced by an update, in
+-- the same JSON shape the API returns. Versions go with the voucher when it
+-- is purged; the audit log keeps the history after that.
+CREATE TABLE IF NOT EXISTS voucher_versions (
+    voucher_id BIGINT NOT NULL REFERENCES vouchers(id) ON DELETE CASCADE,
+    version INTEGER NOT NULL,
+    snapshot JSONB NOT NULL,
+    replaced_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (voucher_id, version)
+);
+
+COMMIT;
@@ -0,0 +1,15 @@
+BEGIN;
+
+-- A stackable voucher may be combined with other stackable vouchers on the
+-- same order. Vouchers sharing an exclusivity_group never combine, even when
+-- both are stackable.
+ALTER TABLE vouchers ADD COLUMN IF NOT EXISTS stackable BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE vouchers ADD COLUMN IF NOT EXISTS exclusivity_group VARCHAR(50);
+
+-- Redeeming or reserving a voucher checks it against the other vouchers
+-- already used on the same order.
+CREATE INDEX IF NOT EXISTS idx_voucher_redemptions_order_reference ON voucher_redemptions (order_reference);
+CREATE INDEX IF NOT EXISTS idx_voucher_reservations_order_reference_held
+    ON voucher_reservations (order_reference) WHERE status = 'held';
+
+COMMIT;
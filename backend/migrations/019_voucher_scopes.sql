@@ -0,0 +1,20 @@
+BEGIN;
+
+-- A voucher with no scope rows applies to every cart line. Include rows
+-- restrict it to the listed SKUs or categories; exclude rows carve lines out
+-- again and always win.
+CREATE TABLE IF NOT EXISTS voucher_skus (
+    voucher_id BIGINT NOT NULL REFERENCES vouchers(id) ON DELETE CASCADE,
+    sku VARCHAR(100) NOT NULL,
+    excluded BOOLEAN NOT NULL DEFAULT FALSE,
+    PRIMARY KEY (voucher_id, excluded, sku)
+);
+
+CREATE TABLE IF NOT EXISTS voucher_categories (
+    voucher_id BIGINT NOT NULL REFERENCES vouchers(id) ON DELETE CASCADE,
+    category_id VARCHAR(100) NOT NULL,
+    excluded BOOLEAN NOT NULL DEFAULT FALSE,
+    PRIMARY KEY (voucher_id, excluded, category_id)
+);
+
+COMMIT;
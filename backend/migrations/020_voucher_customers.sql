@@ -0,0 +1,24 @@
+BEGIN;
+
+-- A personal voucher is bound to one customer and is single-use.
+ALTER TABLE vouchers ADD COLUMN IF NOT EXISTS personal_customer_id VARCHAR(255);
+
+CREATE INDEX IF NOT EXISTS idx_vouchers_personal_customer_id
+    ON vouchers (personal_customer_id) WHERE personal_customer_id IS NOT NULL;
+
+-- A voucher with rows in either allowlist can only be used by a customer
+-- whose ID or email hash (hex SHA-256 of the trimmed, lowercased email) is
+-- listed. Without rows it is open to everyone.
+CREATE TABLE IF NOT EXISTS voucher_customers (
+    voucher_id BIGINT NOT NULL REFERENCES vouchers(id) ON DELETE CASCADE,
+    customer_id VARCHAR(255) NOT NULL,
+    PRIMARY KEY (voucher_id, customer_id)
+);
+
+CREATE TABLE IF NOT EXISTS voucher_customer_emails (
+    voucher_id BIGINT NOT NULL REFERENCES vouchers(id) ON DELETE CASCADE,
+    email_hash CHAR(64) NOT NULL,
+    PRIMARY KEY (voucher_id, email_hash)
+);
+
+COMMIT;
@@ -0,0 +1,9 @@
+BEGIN;
+
+-- valid_from and expiry_date are calendar dates in the voucher's time zone:
+-- a voucher starts at 00:00 on valid_from and expires at 24:00 on
+-- expiry_date. NULL means the business time zone (BUSINESS_TIMEZONE), which
+-- the application sets as the session TimeZone of every connection.
+ALTER TABLE vouchers ADD COLUMN IF NOT EXISTS timezone VARCHAR(64);
+
+COMMIT;
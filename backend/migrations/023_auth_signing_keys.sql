@@ -0,0 +1,21 @@
+BEGIN;
+
+-- Ed25519 keys signing access tokens. private_key is the 32-byte seed. At
+-- most one key is active (retired_at IS NULL); retired keys stay published
+-- in the JWKS until every token they signed has expired, then are deleted.
+CREATE TABLE IF NOT EXISTS auth_signing_keys (
+    kid TEXT PRIMARY KEY,
+    private_key BYTEA NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    retired_at TIMESTAMPTZ
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS ux_auth_signing_keys_active
+    ON auth_signing_keys ((TRUE))
+    WHERE retired_at IS NULL;
+
+-- user_sessions now holds refresh tokens. Sessions created by the old
+-- bearer-token login cannot be refreshed, so drop them.
+DELETE FROM user_sessions;
+
+COMMIT;
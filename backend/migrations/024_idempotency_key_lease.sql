@@ -0,0 +1,15 @@
+BEGIN;
+
+-- An in-progress key is leased to the request that claimed it until
+-- locked_until. A claim whose lease ran out (e.g. the server crashed while
+-- processing it) can be taken over by a retry of the same request;
+-- claim_token tells the new owner apart from the one that lost the lease.
+ALTER TABLE idempotency_keys ADD COLUMN IF NOT EXISTS locked_until TIMESTAMPTZ;
+ALTER TABLE idempotency_keys ADD COLUMN IF NOT EXISTS claim_token TEXT;
+
+-- Claims left over from before the lease existed can be taken over at once.
+UPDATE idempotency_keys
+SET locked_until = NOW()
+WHERE status_code IS NULL AND locked_until IS NULL;
+
+COMMIT;
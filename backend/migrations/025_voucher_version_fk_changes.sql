@@ -0,0 +1,20 @@
+BEGIN;
+
+-- Deleting a campaign detaches its vouchers through ON DELETE SET NULL. That
+-- is not an edit of the voucher, so it keeps its version (and ETag) instead
+-- of getting one that has no snapshot in voucher_versions. Every write path
+-- in the application sets updated_at, so its updates still bump the version
+-- even when campaign_id is the only attribute that changes.
+CREATE OR REPLACE FUNCTION bump_version()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF OLD.campaign_id IS NOT NULL AND NEW.campaign_id IS NULL
+        AND to_jsonb(NEW) - 'campaign_id' = to_jsonb(OLD) - 'campaign_id' THEN
+        RETURN NEW;
+    END IF;
+    NEW.version = OLD.version + 1;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+COMMIT;
@@ -18,7 +18,7 @@ export const AuthProvider: FC<{ children: ReactNode }> = ({ children }) => {
 
   const login = async (credentials: LoginCredentials) => {
     const response = await apiClient.post<LoginResponse>('/login', credentials);
-    const newToken = response.token;
+    const newToken = response.access_token;
 
     localStorage.setItem('token', newToken);
     setToken(newToken);
@@ -11,5 +11,7 @@ export interface AuthContextType {
 }
 
 export interface LoginResponse {
-  token: string;
+  access_token: string;
+  refresh_token: string;
+  expires_in: number;
 }
\ No newline at end of file